@@ -0,0 +1,427 @@
+// Package actor 基于 go-actor 的通用 actor，房间、玩家、公会、匹配队列等都可以复用
+// 每个 actor 在自己的 goroutine 中顺序处理消息、定时器和外部事件源，状态不需要加锁
+package actor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"game_actor/clock"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	goactor "github.com/vladopajic/go-actor/actor"
+)
+
+// ErrStopped actor 已经停止，投递的消息不会再被处理
+var ErrStopped = errors.New("actor stopped")
+
+// Behavior 处理 Tell/Ask 投递的消息，运行在 actor 的 goroutine 中
+// 返回值只对 Ask 有意义
+type Behavior[M any] interface {
+	Receive(msg M) (any, error)
+}
+
+// BehaviorFunc 把普通函数转成 Behavior
+type BehaviorFunc[M any] func(msg M) (any, error)
+
+func (f BehaviorFunc[M]) Receive(msg M) (any, error) {
+	return f(msg)
+}
+
+// Starter Behavior 实现该接口时，在 actor goroutine 中处理第一条消息之前调用
+type Starter interface {
+	OnStart()
+}
+
+// Stopper Behavior 实现该接口时，在 actor goroutine 退出前调用
+type Stopper interface {
+	OnStop()
+}
+
+// Source 额外的事件源，和 mailbox 在同一个 goroutine 中 select，如房间的逻辑帧
+type Source interface {
+	C() <-chan time.Time
+	Fire(now time.Time)
+	Stop()
+}
+
+type Options struct {
+	// mailbox 容量，0 表示无界
+	mailboxSize    int
+	overflow       OverflowPolicy
+	mailboxTimeout time.Duration
+	source         Source
+	onPanic        func(recovered any, stack []byte)
+	clock          clock.Clock
+}
+
+type OptionFunc func(*Options)
+
+// WithMailbox 使用有界 mailbox，队列满时按 policy 处理
+// timeout 只对 OverflowBlock 生效，0 表示一直等待
+// 容量只限制 Tell/Invoke 从外部投递的任务；Call/SyncInvokeCtx 和 actor 自己通过 InvokeCtx(Context()) 投递的任务不占容量，不会被丢弃、拒绝或阻塞
+func WithMailbox(size int, policy OverflowPolicy, timeout time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.mailboxSize = size
+		o.overflow = policy
+		o.mailboxTimeout = timeout
+	}
+}
+
+// WithSource 设置额外的事件源，只支持一个
+func WithSource(src Source) OptionFunc {
+	return func(o *Options) {
+		o.source = src
+	}
+}
+
+// WithClock 设置定时器使用的时钟，测试中可以使用 clock.Fake
+func WithClock(c clock.Clock) OptionFunc {
+	return func(o *Options) {
+		o.clock = c
+	}
+}
+
+// WithPanicHandler 消息、定时器或事件源 panic 后调用，运行在 actor goroutine 中
+// 未设置时只打印日志，actor 继续运行
+func WithPanicHandler(h func(recovered any, stack []byte)) OptionFunc {
+	return func(o *Options) {
+		o.onPanic = h
+	}
+}
+
+// Actor 以 M 为消息类型的 actor，创建后立即启动
+type Actor[M any] struct {
+	kind     string
+	id       int64
+	behavior Behavior[M]
+	option   *Options
+	core     goactor.Actor
+	mailbox  goactor.Mailbox[func()]
+	metrics  *mailboxMetrics
+	timers   *timerQueue
+	// 带有 actor 标记的 context，见 Context
+	ctx context.Context
+	// goroutine 退出后关闭
+	stopped chan struct{}
+	// 调用了 Abandon，不再执行任何消息、定时器和事件源
+	abandoned atomic.Bool
+}
+
+// New 创建并启动 actor，kind 和 id 用于日志和 Registry
+func New[M any](kind string, id int64, behavior Behavior[M], opts ...OptionFunc) *Actor[M] {
+	opt := &Options{clock: clock.Real}
+	for _, o := range opts {
+		o(opt)
+	}
+	a := &Actor[M]{
+		kind:     kind,
+		id:       id,
+		behavior: behavior,
+		option:   opt,
+		metrics:  &mailboxMetrics{capacity: opt.mailboxSize},
+		timers:   newTimerQueue(opt.clock),
+		stopped:  make(chan struct{}),
+	}
+	a.ctx = context.WithValue(context.Background(), ownerKey{}, a)
+	if opt.mailboxSize > 0 {
+		a.mailbox = newBoundedMailbox(opt.mailboxSize, opt.overflow, opt.mailboxTimeout, a.metrics)
+	} else {
+		a.mailbox = goactor.NewMailbox[func()]()
+	}
+	// mailbox 和 worker 一起启动、一起停止
+	a.core = goactor.Combine(a.mailbox, goactor.New(&worker[M]{a})).Build()
+	a.core.Start()
+	return a
+}
+
+func (a *Actor[M]) Kind() string {
+	return a.kind
+}
+
+func (a *Actor[M]) ID() int64 {
+	return a.id
+}
+
+// Tell 异步投递消息，不等待处理结果
+func (a *Actor[M]) Tell(msg M) error {
+	return a.Invoke(func() {
+		a.behavior.Receive(msg)
+	})
+}
+
+// Call 投递消息并等待 Receive 的返回值，强类型版本见 Ask
+func (a *Actor[M]) Call(ctx context.Context, msg M) (any, error) {
+	return a.SyncInvokeCtx(ctx, func() (any, error) {
+		return a.behavior.Receive(msg)
+	})
+}
+
+// Ask 投递消息并等待 Receive 的返回值，返回值类型不是 R 时返回错误
+func Ask[R any, M any](ctx context.Context, a *Actor[M], msg M) (R, error) {
+	var zero R
+	res, err := a.Call(ctx, msg)
+	if err != nil || res == nil {
+		return zero, err
+	}
+	r, ok := res.(R)
+	if !ok {
+		return zero, fmt.Errorf("actor %s/%d: unexpected reply type %T", a.kind, a.id, res)
+	}
+	return r, nil
+}
+
+// Invoke 把函数投递到 actor goroutine 中执行，不等待结果
+// 使用有界 mailbox 时，队列满的处理方式见 WithMailbox
+func (a *Actor[M]) Invoke(f func()) error {
+	return a.send(goactor.ContextStarted(), f, false)
+}
+
+// InvokeCtx 同 Invoke，OverflowBlock 等待队列空间时 ctx 结束返回 ctx.Err()
+// actor 内部投递时传入 Context()，任务不受有界 mailbox 的容量限制，不会等待自己
+func (a *Actor[M]) InvokeCtx(ctx context.Context, f func()) error {
+	return a.send(ctx, f, false)
+}
+
+// send pinned 为 true 时不受有界 mailbox 的容量限制，见 WithMailbox
+func (a *Actor[M]) send(ctx context.Context, f func(), pinned bool) error {
+	a.metrics.push()
+	var err error
+	if mb, ok := a.mailbox.(*boundedMailbox); ok && (pinned || a.InActor(ctx)) {
+		err = mb.SendPinned(ctx, f)
+	} else {
+		err = a.mailbox.Send(ctx, f)
+	}
+	if err != nil {
+		a.metrics.pop()
+		if errors.Is(err, goactor.ErrMailboxStopped) {
+			return ErrStopped
+		}
+		return err
+	}
+	return nil
+}
+
+// SyncInvokeCtx 把函数投递到 actor goroutine 中执行，等待执行结果或 ctx 结束
+// actor 内部调用时传入 Context()，直接执行 f，避免等待自己造成死锁
+// actor 已经停止时返回 ErrStopped；ctx 结束时返回 ctx.Err()，此时 f 仍可能稍后执行
+func (a *Actor[M]) SyncInvokeCtx(ctx context.Context, f func() (any, error)) (any, error) {
+	if a.InActor(ctx) {
+		return f()
+	}
+
+	type result struct {
+		res any
+		err error
+	}
+	done := make(chan result, 1)
+	err := a.send(ctx, func() {
+		res, err := f()
+		done <- result{res, err}
+	}, true)
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case res := <-done:
+		return res.res, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-a.stopped:
+		// 停止前的最后一个任务可能刚好执行完
+		select {
+		case res := <-done:
+			return res.res, res.err
+		default:
+			return nil, ErrStopped
+		}
+	}
+}
+
+// AfterFunc d 之后在 actor goroutine 中执行 f，actor 停止时自动取消
+func (a *Actor[M]) AfterFunc(d time.Duration, f func()) *Timer {
+	return a.timers.add(d, 0, f)
+}
+
+// Every 每隔 d 在 actor goroutine 中执行一次 f，直到 Timer.Stop 或 actor 停止
+func (a *Actor[M]) Every(d time.Duration, f func()) *Timer {
+	return a.timers.add(d, d, f)
+}
+
+// PauseTimers 暂停所有定时器，暂停期间不会触发，新建的定时器从恢复时开始计时
+func (a *Actor[M]) PauseTimers() {
+	a.timers.pause()
+}
+
+// ResumeTimers 恢复定时器，剩余时间和暂停前一致
+func (a *Actor[M]) ResumeTimers() {
+	a.timers.resume()
+}
+
+// RunPending 在 actor goroutine 中立即处理已经触发的定时器和事件源，并等待 mailbox 中已有的消息（包括处理过程中新投递的）执行完
+// 配合 clock.Fake 使用：推进时间后调用，保证到期的定时器在之后投递的消息之前执行
+func (a *Actor[M]) RunPending() error {
+	for {
+		more, err := a.SyncInvokeCtx(context.Background(), func() (any, error) {
+			for a.runPending() {
+			}
+			// 自己已经出队，depth 大于 0 说明后面还有消息
+			return a.metrics.depth.Load() > 0, nil
+		})
+		if err != nil {
+			return err
+		}
+		if !more.(bool) {
+			return nil
+		}
+	}
+}
+
+// runPending 处理一个已经触发的定时器或事件源，没有时返回 false
+func (a *Actor[M]) runPending() bool {
+	var sourceC <-chan time.Time
+	if a.option.source != nil {
+		sourceC = a.option.source.C()
+	}
+	select {
+	case now := <-a.timers.C():
+		a.fireTimers(now)
+	case now := <-sourceC:
+		a.fireSource(now)
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *Actor[M]) fireTimers(now time.Time) {
+	for _, t := range a.timers.due(now) {
+		if t.take() {
+			a.safeRun(t.f)
+		}
+	}
+}
+
+func (a *Actor[M]) fireSource(now time.Time) {
+	a.safeRun(func() {
+		a.option.source.Fire(now)
+	})
+}
+
+type ownerKey struct{}
+
+// Context 带有 actor 标记的 context，只在 actor goroutine 中（消息、定时器、事件源）使用
+// 传给 SyncInvokeCtx/InvokeCtx/Call 表示调用来自 actor 自身；在其他 goroutine 中使用会和 actor 并发执行
+func (a *Actor[M]) Context() context.Context {
+	return a.ctx
+}
+
+// InActor ctx 是否来自 Context()，即调用方声明自己运行在 actor goroutine 中
+func (a *Actor[M]) InActor(ctx context.Context) bool {
+	owner, _ := ctx.Value(ownerKey{}).(*Actor[M])
+	return owner == a
+}
+
+// MailboxStats 获取 mailbox 的排队、丢弃统计
+func (a *Actor[M]) MailboxStats() MailboxStats {
+	return a.metrics.stats()
+}
+
+// Stop 停止 actor 并等待 goroutine 退出，未处理的消息会被丢弃
+// 会等待 actor 执行完当前任务，不能在 actor goroutine 中调用，actor 内部使用 StopAsync
+func (a *Actor[M]) Stop() {
+	a.core.Stop()
+}
+
+// StopAsync 通知 actor 停止，不等待 goroutine 退出，可以在 actor 内部调用，退出后 Stopped 关闭
+func (a *Actor[M]) StopAsync() {
+	go a.core.Stop()
+}
+
+// Abandon 停止 actor 并丢弃 mailbox 中还没有执行的消息，定时器和事件源也不再触发
+// 用于状态已经转交出去的场景（如房间迁移）；不等待 goroutine 退出，在 actor goroutine 中调用时当前任务仍会执行完
+func (a *Actor[M]) Abandon() {
+	a.abandoned.Store(true)
+	a.StopAsync()
+}
+
+// Stopped actor goroutine 退出后关闭
+func (a *Actor[M]) Stopped() <-chan struct{} {
+	return a.stopped
+}
+
+// safeRun 捕获 panic，避免一个 actor 的错误导致整个进程退出
+func (a *Actor[M]) safeRun(f func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			a.handlePanic(v, debug.Stack())
+		}
+	}()
+	f()
+}
+
+func (a *Actor[M]) handlePanic(recovered any, stack []byte) {
+	if a.option.onPanic == nil {
+		log.Printf("Actor %s/%d panic: %v\n%s", a.kind, a.id, recovered, stack)
+		return
+	}
+	// panic handler 自身 panic 时只记录日志
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("Actor %s/%d panic handler panic: %v", a.kind, a.id, v)
+		}
+	}()
+	a.option.onPanic(recovered, stack)
+}
+
+type worker[M any] struct {
+	a *Actor[M]
+}
+
+func (w *worker[M]) OnStart(goactor.Context) {
+	if s, ok := w.a.behavior.(Starter); ok {
+		w.a.safeRun(s.OnStart)
+	}
+}
+
+// DoWork 消息、定时器和事件源在同一个 goroutine 中 select，保证不会并发执行
+func (w *worker[M]) DoWork(ctx goactor.Context) goactor.WorkerStatus {
+	a := w.a
+	if a.abandoned.Load() {
+		return goactor.WorkerEnd
+	}
+	var sourceC <-chan time.Time
+	if a.option.source != nil {
+		sourceC = a.option.source.C()
+	}
+	select {
+	case <-ctx.Done():
+		return goactor.WorkerEnd
+	case fn, ok := <-a.mailbox.ReceiveC():
+		if !ok {
+			return goactor.WorkerEnd
+		}
+		a.metrics.pop()
+		a.safeRun(fn)
+	case now := <-a.timers.C():
+		a.fireTimers(now)
+	case now := <-sourceC:
+		a.fireSource(now)
+	}
+	return goactor.WorkerContinue
+}
+
+func (w *worker[M]) OnStop() {
+	a := w.a
+	if a.option.source != nil {
+		a.option.source.Stop()
+	}
+	a.timers.stop()
+	if s, ok := a.behavior.(Stopper); ok {
+		a.safeRun(s.OnStop)
+	}
+	close(a.stopped)
+}
@@ -0,0 +1,234 @@
+package actor
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goactor "github.com/vladopajic/go-actor/actor"
+)
+
+var (
+	ErrMailboxFull    = errors.New("actor mailbox full")
+	ErrMailboxTimeout = errors.New("actor mailbox send timeout")
+)
+
+// OverflowPolicy 有界 mailbox 满了之后的处理方式
+type OverflowPolicy int
+
+const (
+	// 阻塞等待空位，超过 timeout 返回 ErrMailboxTimeout，timeout 为 0 时一直等待
+	OverflowBlock OverflowPolicy = iota
+	// 丢弃新投递的任务，Invoke 返回 nil
+	OverflowDropNewest
+	// 丢弃队列中最早的任务，为新任务腾出位置
+	OverflowDropOldest
+	// 拒绝新投递的任务，Invoke 返回 ErrMailboxFull
+	OverflowReject
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop_newest"
+	case OverflowDropOldest:
+		return "drop_oldest"
+	case OverflowReject:
+		return "reject"
+	}
+	return "unknown"
+}
+
+// MailboxStats mailbox 的统计，用于观察哪些 actor 处理不过来
+type MailboxStats struct {
+	// 排队中还未执行的任务数
+	Depth int64 `json:"depth"`
+	// 历史最大排队数
+	MaxDepth int64 `json:"max_depth"`
+	// 容量，0 表示无界
+	Capacity int `json:"capacity"`
+	// 因队列满被丢弃的任务数（drop newest / drop oldest）
+	Dropped int64 `json:"dropped"`
+	// 因队列满被拒绝或等待超时的任务数
+	Rejected int64 `json:"rejected"`
+}
+
+// mailboxMetrics 由投递方和 actor goroutine 并发更新
+type mailboxMetrics struct {
+	capacity int
+	depth    atomic.Int64
+	maxDepth atomic.Int64
+	dropped  atomic.Int64
+	rejected atomic.Int64
+}
+
+func (m *mailboxMetrics) push() {
+	depth := m.depth.Add(1)
+	for {
+		max := m.maxDepth.Load()
+		if depth <= max || m.maxDepth.CompareAndSwap(max, depth) {
+			return
+		}
+	}
+}
+
+func (m *mailboxMetrics) pop() {
+	m.depth.Add(-1)
+}
+
+func (m *mailboxMetrics) stats() MailboxStats {
+	return MailboxStats{
+		Depth:    m.depth.Load(),
+		MaxDepth: m.maxDepth.Load(),
+		Capacity: m.capacity,
+		Dropped:  m.dropped.Load(),
+		Rejected: m.rejected.Load(),
+	}
+}
+
+// boundedMailbox 固定容量的 mailbox，满了之后按 policy 处理
+// 底层是无界队列，容量只限制普通的异步任务；pinned 任务（SyncInvoke 和 actor 自己投递的任务）
+// 不占容量、不会被丢弃或拒绝：SyncInvoke 的调用方在等待结果，每个调用方同时只有一个任务在队列中；
+// actor 内部投递的任务如果阻塞会等待自己，造成死锁
+type boundedMailbox struct {
+	queue   goactor.Mailbox[func()]
+	size    int
+	policy  OverflowPolicy
+	timeout time.Duration
+	metrics *mailboxMetrics
+
+	mu sync.Mutex
+	// 队列中还未执行的普通任务，按投递顺序排列
+	pending []*boundedTask
+	// 有普通任务出队时通知阻塞中的 Send
+	space   chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// boundedTask 被 drop oldest 丢弃的任务仍留在底层队列中，actor 取到后跳过
+type boundedTask struct {
+	f       func()
+	dropped bool
+}
+
+func newBoundedMailbox(size int, policy OverflowPolicy, timeout time.Duration, metrics *mailboxMetrics) *boundedMailbox {
+	return &boundedMailbox{
+		queue:   goactor.NewMailbox[func()](),
+		size:    size,
+		policy:  policy,
+		timeout: timeout,
+		metrics: metrics,
+		space:   make(chan struct{}, 1),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (m *boundedMailbox) Start() {
+	m.queue.Start()
+}
+
+func (m *boundedMailbox) Stop() {
+	// 先唤醒阻塞中的 Send
+	m.once.Do(func() {
+		close(m.stopped)
+	})
+	m.queue.Stop()
+}
+
+func (m *boundedMailbox) ReceiveC() <-chan func() {
+	return m.queue.ReceiveC()
+}
+
+// SendPinned 不受容量限制地投递任务
+func (m *boundedMailbox) SendPinned(ctx goactor.Context, f func()) error {
+	return m.queue.Send(ctx, f)
+}
+
+// Send ctx 取消时停止等待，超时由 policy 的 timeout 控制
+func (m *boundedMailbox) Send(ctx goactor.Context, f func()) error {
+	var timeout <-chan time.Time
+	for {
+		select {
+		case <-m.stopped:
+			return ErrStopped
+		default:
+		}
+
+		m.mu.Lock()
+		if len(m.pending) < m.size {
+			err := m.enqueue(ctx, f)
+			m.mu.Unlock()
+			return err
+		}
+		switch m.policy {
+		case OverflowDropNewest:
+			m.mu.Unlock()
+			m.metrics.dropped.Add(1)
+			m.metrics.pop()
+			return nil
+		case OverflowDropOldest:
+			// 被丢弃的任务在 actor 跳过它之前仍计入 Depth
+			oldest := m.pending[0]
+			oldest.dropped = true
+			oldest.f = nil
+			m.pending = m.pending[1:]
+			m.metrics.dropped.Add(1)
+			err := m.enqueue(ctx, f)
+			m.mu.Unlock()
+			return err
+		case OverflowReject:
+			m.mu.Unlock()
+			m.metrics.rejected.Add(1)
+			return ErrMailboxFull
+		}
+		m.mu.Unlock()
+
+		if timeout == nil && m.timeout > 0 {
+			timer := time.NewTimer(m.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+		select {
+		case <-m.space:
+		case <-timeout:
+			m.metrics.rejected.Add(1)
+			return ErrMailboxTimeout
+		case <-m.stopped:
+			return ErrStopped
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// enqueue 调用方持有 mu
+func (m *boundedMailbox) enqueue(ctx goactor.Context, f func()) error {
+	t := &boundedTask{f: f}
+	if err := m.queue.Send(ctx, func() { m.run(t) }); err != nil {
+		return err
+	}
+	m.pending = append(m.pending, t)
+	return nil
+}
+
+// run 在 actor goroutine 中执行普通任务，任务出队后腾出一个位置
+func (m *boundedMailbox) run(t *boundedTask) {
+	m.mu.Lock()
+	if t.dropped {
+		m.mu.Unlock()
+		return
+	}
+	// 没有被丢弃的任务按顺序出队，一定在队首
+	m.pending = m.pending[1:]
+	f := t.f
+	m.mu.Unlock()
+	select {
+	case m.space <- struct{}{}:
+	default:
+	}
+	f()
+}
@@ -0,0 +1,214 @@
+package actor_test
+
+import (
+	"context"
+	"errors"
+	"game_actor/actor"
+	"slices"
+	"testing"
+	"time"
+)
+
+// recorder 记录任务的执行顺序，只在 actor goroutine 中写入
+type recorder struct {
+	a   *actor.Actor[func()]
+	log []string
+}
+
+func newBounded(t *testing.T, size int, policy actor.OverflowPolicy, timeout time.Duration) *recorder {
+	t.Helper()
+	a := actor.New[func()]("test", 1, actor.BehaviorFunc[func()](func(f func()) (any, error) {
+		f()
+		return nil, nil
+	}), actor.WithMailbox(size, policy, timeout))
+	t.Cleanup(a.Stop)
+	return &recorder{a: a}
+}
+
+// block 让 actor 阻塞在一个任务中，之后投递的任务都留在队列里，返回值用于放行
+func (r *recorder) block(t *testing.T) func() {
+	t.Helper()
+	started := make(chan struct{})
+	gate := make(chan struct{})
+	if err := r.a.Invoke(func() {
+		close(started)
+		<-gate
+	}); err != nil {
+		t.Fatalf("block: %v", err)
+	}
+	<-started
+	return func() { close(gate) }
+}
+
+func (r *recorder) invoke(name string) error {
+	return r.a.Invoke(func() {
+		r.log = append(r.log, name)
+	})
+}
+
+// syncInvoke 队列满时投递 SyncInvoke，等待超时返回，任务留在队列中
+func (r *recorder) syncInvoke(t *testing.T, name string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := r.a.SyncInvokeCtx(ctx, func() (any, error) {
+		r.log = append(r.log, name)
+		return nil, nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("sync invoke: got %v, want deadline exceeded", err)
+	}
+}
+
+func (r *recorder) drain(t *testing.T) []string {
+	t.Helper()
+	if err := r.a.RunPending(); err != nil {
+		t.Fatalf("run pending: %v", err)
+	}
+	return r.log
+}
+
+func TestMailboxDropNewest(t *testing.T) {
+	r := newBounded(t, 2, actor.OverflowDropNewest, 0)
+	release := r.block(t)
+	for _, name := range []string{"a", "b", "c"} {
+		if err := r.invoke(name); err != nil {
+			t.Fatalf("invoke %s: %v", name, err)
+		}
+	}
+	r.syncInvoke(t, "sync")
+	release()
+
+	if got, want := r.drain(t), []string{"a", "b", "sync"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if stats := r.a.MailboxStats(); stats.Dropped != 1 || stats.Depth != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMailboxDropOldest(t *testing.T) {
+	r := newBounded(t, 2, actor.OverflowDropOldest, 0)
+	release := r.block(t)
+	r.invoke("a")
+	r.syncInvoke(t, "sync")
+	r.invoke("b")
+	// 丢弃最早的普通任务 a，排在前面的 SyncInvoke 保留
+	r.invoke("c")
+	release()
+
+	if got, want := r.drain(t), []string{"sync", "b", "c"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if stats := r.a.MailboxStats(); stats.Dropped != 1 || stats.Depth != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMailboxReject(t *testing.T) {
+	r := newBounded(t, 2, actor.OverflowReject, 0)
+	release := r.block(t)
+	r.invoke("a")
+	r.invoke("b")
+	if err := r.invoke("c"); !errors.Is(err, actor.ErrMailboxFull) {
+		t.Fatalf("got %v, want ErrMailboxFull", err)
+	}
+	r.syncInvoke(t, "sync")
+	// SyncInvoke 不占容量，但计入排队数
+	if stats := r.a.MailboxStats(); stats.Rejected != 1 || stats.Depth != 3 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	release()
+
+	if got, want := r.drain(t), []string{"a", "b", "sync"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestMailboxBlock(t *testing.T) {
+	r := newBounded(t, 2, actor.OverflowBlock, 20*time.Millisecond)
+	release := r.block(t)
+	r.invoke("a")
+	r.invoke("b")
+	if err := r.invoke("c"); !errors.Is(err, actor.ErrMailboxTimeout) {
+		t.Fatalf("got %v, want ErrMailboxTimeout", err)
+	}
+	r.syncInvoke(t, "sync")
+
+	// 有空位后阻塞中的投递继续
+	sent := make(chan error, 1)
+	go func() {
+		sent <- r.invoke("d")
+	}()
+	release()
+	if err := <-sent; err != nil {
+		t.Fatalf("blocked invoke: %v", err)
+	}
+
+	if got, want := r.drain(t), []string{"a", "b", "sync", "d"}; !slices.Equal(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if stats := r.a.MailboxStats(); stats.Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+// actor 内部通过 Context() 投递的任务不受容量限制，OverflowBlock 下也不会等待自己
+func TestMailboxReentrant(t *testing.T) {
+	policies := []actor.OverflowPolicy{actor.OverflowBlock, actor.OverflowDropNewest, actor.OverflowDropOldest, actor.OverflowReject}
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			r := newBounded(t, 1, policy, 0)
+			errs := make(chan error, 1)
+			r.a.Invoke(func() {
+				var err error
+				for _, name := range []string{"a", "b", "c"} {
+					err = errors.Join(err, r.a.InvokeCtx(r.a.Context(), func() {
+						r.log = append(r.log, name)
+					}))
+				}
+				errs <- err
+			})
+
+			done := make(chan error, 1)
+			go func() {
+				done <- r.a.RunPending()
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatalf("run pending: %v", err)
+				}
+				if want := []string{"a", "b", "c"}; !slices.Equal(r.log, want) {
+					t.Fatalf("got %v, want %v", r.log, want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("actor blocked on its own mailbox")
+			}
+			if err := <-errs; err != nil {
+				t.Fatalf("reentrant invoke: %v", err)
+			}
+		})
+	}
+}
+
+// actor 内部传入 Context() 的 SyncInvokeCtx 直接执行，不会等待自己；其他 ctx 不能借用 actor 的身份
+func TestSyncInvokeReentrant(t *testing.T) {
+	r := newBounded(t, 1, actor.OverflowBlock, 0)
+	if r.a.InActor(context.Background()) || !r.a.InActor(r.a.Context()) {
+		t.Fatal("InActor does not match the actor context")
+	}
+	other := newBounded(t, 1, actor.OverflowBlock, 0)
+	if other.a.InActor(r.a.Context()) {
+		t.Fatal("context of another actor accepted")
+	}
+
+	res, err := r.a.SyncInvokeCtx(context.Background(), func() (any, error) {
+		return r.a.SyncInvokeCtx(r.a.Context(), func() (any, error) {
+			return "inline", nil
+		})
+	})
+	if err != nil || res != "inline" {
+		t.Fatalf("reentrant sync invoke: %v, %v", res, err)
+	}
+}
@@ -0,0 +1,76 @@
+package actor
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrAlreadyRegistered = errors.New("actor already registered")
+
+// Ref 不关心消息类型的 actor 引用，所有 *Actor[M] 都实现了该接口
+type Ref interface {
+	Kind() string
+	ID() int64
+	Stop()
+	Stopped() <-chan struct{}
+}
+
+type registryKey struct {
+	kind string
+	id   int64
+}
+
+// Registry 本地 actor 注册表，按 kind 和 id 查找，actor 停止后自动注销
+type Registry struct {
+	actors sync.Map // registryKey -> Ref
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register 注册 actor，同 kind 同 id 的 actor 已存在时返回 ErrAlreadyRegistered
+func (r *Registry) Register(ref Ref) error {
+	key := registryKey{ref.Kind(), ref.ID()}
+	if _, loaded := r.actors.LoadOrStore(key, ref); loaded {
+		return ErrAlreadyRegistered
+	}
+	go func() {
+		<-ref.Stopped()
+		r.actors.CompareAndDelete(key, ref)
+	}()
+	return nil
+}
+
+// Unregister 注销 actor，不会停止它
+func (r *Registry) Unregister(kind string, id int64) {
+	r.actors.Delete(registryKey{kind, id})
+}
+
+func (r *Registry) Get(kind string, id int64) (Ref, bool) {
+	ref, ok := r.actors.Load(registryKey{kind, id})
+	if !ok {
+		return nil, false
+	}
+	return ref.(Ref), true
+}
+
+// Range 遍历指定 kind 的 actor，f 返回 false 时停止遍历
+func (r *Registry) Range(kind string, f func(ref Ref) bool) {
+	r.actors.Range(func(key, value any) bool {
+		if key.(registryKey).kind != kind {
+			return true
+		}
+		return f(value.(Ref))
+	})
+}
+
+// Lookup 查找指定消息类型的 actor，类型不匹配时返回 false
+func Lookup[M any](r *Registry, kind string, id int64) (*Actor[M], bool) {
+	ref, ok := r.Get(kind, id)
+	if !ok {
+		return nil, false
+	}
+	a, ok := ref.(*Actor[M])
+	return a, ok
+}
@@ -0,0 +1,185 @@
+package actor
+
+import (
+	"container/heap"
+	"game_actor/clock"
+	"sync"
+	"time"
+)
+
+// Timer AfterFunc/Every 返回的句柄，可以在任意 goroutine 中 Stop
+type Timer struct {
+	q      *timerQueue
+	at     time.Time
+	period time.Duration
+	f      func()
+	// 在堆中的下标，-1 表示不在堆中
+	index int
+	// 已经停止，或者一次性定时器已经执行
+	done bool
+}
+
+// Stop 停止定时器，返回 false 表示定时器已经执行过或已经停止
+func (t *Timer) Stop() bool {
+	return t.q.remove(t)
+}
+
+// take 执行前检查定时器是否在到期之后被停止
+func (t *Timer) take() bool {
+	t.q.mu.Lock()
+	defer t.q.mu.Unlock()
+	if t.done {
+		return false
+	}
+	if t.period == 0 {
+		t.done = true
+	}
+	return true
+}
+
+type timerHeap []*Timer
+
+func (h timerHeap) Len() int           { return len(h) }
+func (h timerHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	t := x.(*Timer)
+	t.index = len(*h)
+	*h = append(*h, t)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	t.index = -1
+	*h = old[:len(old)-1]
+	return t
+}
+
+// timerQueue actor 的定时器，按到期时间排成最小堆，只用一个底层 timer 唤醒 actor goroutine
+type timerQueue struct {
+	mu     sync.Mutex
+	clock  clock.Clock
+	heap   timerHeap
+	wake   clock.Timer
+	closed bool
+	// 暂停期间时间停在 pausedAt，恢复后所有定时器顺延暂停的时长
+	paused   bool
+	pausedAt time.Time
+}
+
+func newTimerQueue(c clock.Clock) *timerQueue {
+	wake := c.NewTimer(time.Hour)
+	wake.Stop()
+	return &timerQueue{clock: c, wake: wake}
+}
+
+func (q *timerQueue) C() <-chan time.Time {
+	return q.wake.C()
+}
+
+func (q *timerQueue) add(d, period time.Duration, f func()) *Timer {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := q.clock.Now()
+	if q.paused {
+		now = q.pausedAt
+	}
+	t := &Timer{q: q, at: now.Add(d), period: period, f: f, index: -1}
+	if q.closed {
+		t.done = true
+		return t
+	}
+	heap.Push(&q.heap, t)
+	if t.index == 0 && !q.paused {
+		q.wake.Reset(d)
+	}
+	return t
+}
+
+func (q *timerQueue) remove(t *Timer) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	if t.index >= 0 {
+		heap.Remove(&q.heap, t.index)
+	}
+	return true
+}
+
+// due 取出所有到期的定时器，周期定时器按周期重新入队
+func (q *timerQueue) due(now time.Time) []*Timer {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused {
+		return nil
+	}
+	var fired []*Timer
+	for len(q.heap) > 0 && !q.heap[0].at.After(now) {
+		t := heap.Pop(&q.heap).(*Timer)
+		fired = append(fired, t)
+		if t.period > 0 {
+			// 落后超过一个周期时不补执行，从当前时间重新计算
+			t.at = t.at.Add(t.period)
+			if !t.at.After(now) {
+				t.at = now.Add(t.period)
+			}
+			heap.Push(&q.heap, t)
+		}
+	}
+	if len(q.heap) > 0 {
+		q.wake.Reset(q.heap[0].at.Sub(now))
+	}
+	return fired
+}
+
+func (q *timerQueue) pause() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.paused || q.closed {
+		return
+	}
+	q.paused = true
+	q.pausedAt = q.clock.Now()
+	q.wake.Stop()
+}
+
+func (q *timerQueue) resume() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.paused {
+		return
+	}
+	q.paused = false
+	now := q.clock.Now()
+	// 所有定时器顺延相同的时长，堆的顺序不变
+	shift := now.Sub(q.pausedAt)
+	for _, t := range q.heap {
+		t.at = t.at.Add(shift)
+	}
+	if len(q.heap) > 0 {
+		q.wake.Reset(q.heap[0].at.Sub(now))
+	}
+}
+
+// stop actor 停止时取消所有定时器
+func (q *timerQueue) stop() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	for _, t := range q.heap {
+		t.done = true
+		t.index = -1
+	}
+	q.heap = nil
+	q.wake.Stop()
+}
@@ -0,0 +1,166 @@
+package actor_test
+
+import (
+	"game_actor/actor"
+	"game_actor/clock"
+	"slices"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// timerActor 使用 clock.Fake 的 actor，fired 记录定时器触发时的虚拟时间（相对 epoch）
+type timerActor struct {
+	a     *actor.Actor[func()]
+	clock *clock.Fake
+	fired []string
+}
+
+func newTimerActor(t *testing.T) *timerActor {
+	t.Helper()
+	c := clock.NewFake(epoch)
+	a := actor.New[func()]("test", 1, actor.BehaviorFunc[func()](func(f func()) (any, error) {
+		f()
+		return nil, nil
+	}), actor.WithClock(c))
+	t.Cleanup(a.Stop)
+	return &timerActor{a: a, clock: c}
+}
+
+// record 返回一个定时器回调，触发时记录名字和当前时间
+func (ta *timerActor) record(name string) func() {
+	return func() {
+		ta.fired = append(ta.fired, name+"@"+ta.clock.Now().Sub(epoch).String())
+	}
+}
+
+// advance 推进虚拟时间并等待到期的定时器执行完
+func (ta *timerActor) advance(t *testing.T, d time.Duration) {
+	t.Helper()
+	ta.clock.Advance(d)
+	if err := ta.a.RunPending(); err != nil {
+		t.Fatalf("run pending: %v", err)
+	}
+}
+
+func (ta *timerActor) assertFired(t *testing.T, want ...string) {
+	t.Helper()
+	if !slices.Equal(ta.fired, want) {
+		t.Fatalf("fired %v, want %v", ta.fired, want)
+	}
+}
+
+// 同一次推进中到期的定时器按到期时间顺序执行
+func TestTimerOrder(t *testing.T) {
+	ta := newTimerActor(t)
+	ta.a.AfterFunc(30*time.Millisecond, ta.record("c"))
+	ta.a.AfterFunc(10*time.Millisecond, ta.record("a"))
+	ta.a.AfterFunc(20*time.Millisecond, ta.record("b"))
+	ta.a.AfterFunc(40*time.Millisecond, ta.record("d"))
+
+	ta.advance(t, 9*time.Millisecond)
+	ta.assertFired(t)
+	ta.advance(t, 21*time.Millisecond)
+	ta.assertFired(t, "a@30ms", "b@30ms", "c@30ms")
+	ta.advance(t, 10*time.Millisecond)
+	ta.assertFired(t, "a@30ms", "b@30ms", "c@30ms", "d@40ms")
+}
+
+// 停止的定时器不再触发，已经触发或已经停止的定时器 Stop 返回 false
+func TestTimerStop(t *testing.T) {
+	ta := newTimerActor(t)
+	a := ta.a.AfterFunc(10*time.Millisecond, ta.record("a"))
+	b := ta.a.AfterFunc(10*time.Millisecond, ta.record("b"))
+	if !a.Stop() {
+		t.Fatal("stop pending timer returned false")
+	}
+	if a.Stop() {
+		t.Fatal("stop twice returned true")
+	}
+	ta.advance(t, 10*time.Millisecond)
+	ta.assertFired(t, "b@10ms")
+	if b.Stop() {
+		t.Fatal("stop fired timer returned true")
+	}
+}
+
+// 同一批到期的定时器中，先执行的定时器停止了后面的定时器，后面的不再执行
+func TestTimerStopInBatch(t *testing.T) {
+	ta := newTimerActor(t)
+	var b *actor.Timer
+	ta.a.AfterFunc(5*time.Millisecond, func() {
+		ta.record("a")()
+		if !b.Stop() {
+			t.Error("stop due timer returned false")
+		}
+	})
+	b = ta.a.AfterFunc(10*time.Millisecond, ta.record("b"))
+	ta.advance(t, 10*time.Millisecond)
+	ta.assertFired(t, "a@10ms")
+}
+
+// 周期定时器按计划时间而不是触发时间计算下一次，落后超过一个周期时不补执行
+func TestTimerEvery(t *testing.T) {
+	ta := newTimerActor(t)
+	tick := ta.a.Every(10*time.Millisecond, ta.record("tick"))
+
+	ta.advance(t, 10*time.Millisecond)
+	// 晚 2ms 触发，下一次仍在 30ms
+	ta.advance(t, 12*time.Millisecond)
+	ta.advance(t, 7*time.Millisecond)
+	ta.assertFired(t, "tick@10ms", "tick@22ms")
+	ta.advance(t, 1*time.Millisecond)
+	ta.assertFired(t, "tick@10ms", "tick@22ms", "tick@30ms")
+
+	// 一次推进 35ms 只触发一次，下一次从 65ms 开始计算
+	ta.fired = nil
+	ta.advance(t, 35*time.Millisecond)
+	ta.advance(t, 9*time.Millisecond)
+	ta.assertFired(t, "tick@65ms")
+	ta.advance(t, 1*time.Millisecond)
+	ta.assertFired(t, "tick@65ms", "tick@75ms")
+
+	tick.Stop()
+	ta.advance(t, time.Second)
+	ta.assertFired(t, "tick@65ms", "tick@75ms")
+}
+
+// 暂停期间定时器不触发，恢复后剩余时间不变，暂停中新建的定时器从恢复时开始计时
+func TestTimerPause(t *testing.T) {
+	ta := newTimerActor(t)
+	ta.a.AfterFunc(10*time.Millisecond, ta.record("a"))
+	ta.a.Every(20*time.Millisecond, ta.record("tick"))
+
+	ta.advance(t, 5*time.Millisecond)
+	ta.a.PauseTimers()
+	ta.advance(t, 100*time.Millisecond)
+	ta.a.AfterFunc(10*time.Millisecond, ta.record("b"))
+	ta.advance(t, 100*time.Millisecond)
+	ta.assertFired(t)
+
+	ta.a.ResumeTimers()
+	ta.advance(t, 4*time.Millisecond)
+	ta.assertFired(t)
+	ta.advance(t, 1*time.Millisecond)
+	ta.assertFired(t, "a@210ms")
+	ta.advance(t, 5*time.Millisecond)
+	ta.assertFired(t, "a@210ms", "b@215ms")
+	ta.advance(t, 5*time.Millisecond)
+	ta.assertFired(t, "a@210ms", "b@215ms", "tick@220ms")
+	ta.advance(t, 20*time.Millisecond)
+	ta.assertFired(t, "a@210ms", "b@215ms", "tick@220ms", "tick@240ms")
+}
+
+// actor 停止后定时器全部取消
+func TestTimerActorStop(t *testing.T) {
+	ta := newTimerActor(t)
+	timer := ta.a.AfterFunc(10*time.Millisecond, ta.record("a"))
+	ta.a.Stop()
+	if timer.Stop() {
+		t.Fatal("timer still pending after actor stopped")
+	}
+	if n := ta.clock.Pending(); n != 0 {
+		t.Fatalf("%d fake timers pending after actor stopped", n)
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"errors"
+	"game_actor/session"
+	"time"
+)
+
+var (
+	ErrMissingToken  = errors.New("missing token")
+	ErrInvalidTicket = errors.New("invalid ticket")
+	ErrTicketExpired = errors.New("ticket expired")
+	ErrWrongNode     = errors.New("ticket not issued for this node")
+)
+
+// Identity 鉴权通过后连接绑定的身份
+type Identity struct {
+	UID int64 `json:"uid"`
+	// 允许进入的房间，0 表示不限制
+	RoomID int64 `json:"room_id"`
+	// 签发给哪个节点，空表示不限制
+	NodeID   string    `json:"node_id"`
+	ExpireAt time.Time `json:"-"`
+}
+
+// Authenticator 校验客户端携带的凭证
+type Authenticator interface {
+	Authenticate(token string) (*Identity, error)
+}
+
+// Source 凭证的来源，可以组合使用
+type Source int
+
+const (
+	// URL query 参数 ticket
+	SourceQuery Source = 1 << iota
+	// Authorization: Bearer xxx 或 X-Ticket 请求头
+	SourceHeader
+	// 连接建立后的第一条消息
+	SourceFirstMessage
+
+	SourceAll = SourceQuery | SourceHeader | SourceFirstMessage
+)
+
+// Carrier 能保存身份的 session
+type Carrier interface {
+	Identity() *Identity
+	SetIdentity(id *Identity)
+}
+
+// Bind 把身份绑定到 session 上
+func Bind(sess session.Session, id *Identity) {
+	sess.SetUserID(id.UID)
+	if c, ok := sess.(Carrier); ok {
+		c.SetIdentity(id)
+	}
+}
+
+// IdentityOf 获取 session 上绑定的身份，未鉴权的连接返回 false
+func IdentityOf(sess session.Session) (*Identity, bool) {
+	c, ok := sess.(Carrier)
+	if !ok || c.Identity() == nil {
+		return nil, false
+	}
+	return c.Identity(), true
+}
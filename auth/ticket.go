@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// ticketPayload 票据内容，签名覆盖整个 payload
+type ticketPayload struct {
+	*Identity
+	Expire int64 `json:"exp"`
+}
+
+// IssueTicket 签发票据，一般由匹配服在分配节点后调用
+// 格式为 base64url(payload).base64url(hmac-sha256(payload))
+func IssueTicket(secret []byte, id *Identity) (string, error) {
+	payload, err := json.Marshal(&ticketPayload{Identity: id, Expire: id.ExpireAt.Unix()})
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(secret, encoded)), nil
+}
+
+// TicketAuthenticator 校验 HMAC 签名的票据，票据绑定 uid、房间、节点和过期时间
+type TicketAuthenticator struct {
+	secret []byte
+	nodeID string
+	now    func() time.Time
+}
+
+// NewTicketAuthenticator nodeID 为当前节点，签发给其他节点的票据会被拒绝
+func NewTicketAuthenticator(secret []byte, nodeID string) *TicketAuthenticator {
+	return &TicketAuthenticator{
+		secret: secret,
+		nodeID: nodeID,
+		now:    time.Now,
+	}
+}
+
+// Issue 使用同一个密钥签发票据，迁移房间时生成续连凭证用
+func (a *TicketAuthenticator) Issue(id *Identity) (string, error) {
+	return IssueTicket(a.secret, id)
+}
+
+func (a *TicketAuthenticator) Authenticate(token string) (*Identity, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidTicket
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(sig, sign(a.secret, encoded)) {
+		return nil, ErrInvalidTicket
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidTicket
+	}
+	ticket := &ticketPayload{Identity: new(Identity)}
+	if err := json.Unmarshal(payload, ticket); err != nil || ticket.UID == 0 {
+		return nil, ErrInvalidTicket
+	}
+	ticket.ExpireAt = time.Unix(ticket.Expire, 0)
+	if !a.now().Before(ticket.ExpireAt) {
+		return nil, ErrTicketExpired
+	}
+	if ticket.NodeID != "" && ticket.NodeID != a.nodeID {
+		return nil, ErrWrongNode
+	}
+	return ticket.Identity, nil
+}
+
+func sign(secret []byte, data string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
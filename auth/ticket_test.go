@@ -0,0 +1,87 @@
+package auth_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"game_actor/auth"
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("ticket secret")
+
+func issue(t *testing.T, id *auth.Identity) string {
+	t.Helper()
+	ticket, err := auth.IssueTicket(secret, id)
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	return ticket
+}
+
+// signed 用正确的密钥签名任意 payload，用于覆盖签名通过之后的格式检查
+func signed(payload string) string {
+	encoded := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(encoded))
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestTicketRoundTrip(t *testing.T) {
+	expire := time.Now().Add(time.Minute).Truncate(time.Second)
+	a := auth.NewTicketAuthenticator(secret, "node-1")
+	ticket := issue(t, &auth.Identity{UID: 7, RoomID: 100, NodeID: "node-1", ExpireAt: expire})
+	id, err := a.Authenticate(ticket)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if id.UID != 7 || id.RoomID != 100 || id.NodeID != "node-1" || !id.ExpireAt.Equal(expire) {
+		t.Fatalf("got identity %+v", id)
+	}
+
+	// 不绑定节点的票据在任何节点都可以使用
+	other := auth.NewTicketAuthenticator(secret, "node-2")
+	if _, err := other.Authenticate(issue(t, &auth.Identity{UID: 7, ExpireAt: expire})); err != nil {
+		t.Fatalf("authenticate unbound ticket: %v", err)
+	}
+}
+
+func TestTicketRejected(t *testing.T) {
+	expire := time.Now().Add(time.Minute)
+	a := auth.NewTicketAuthenticator(secret, "node-1")
+	valid := issue(t, &auth.Identity{UID: 7, RoomID: 100, NodeID: "node-1", ExpireAt: expire})
+	encoded, signature, _ := strings.Cut(valid, ".")
+
+	// 修改 payload 重新绑定房间，签名不再匹配
+	forged, _ := json.Marshal(map[string]any{"uid": 7, "room_id": 200, "node_id": "node-1", "exp": expire.Unix()})
+	rebound := base64.RawURLEncoding.EncodeToString(forged) + "." + signature
+
+	otherSecret, err := auth.IssueTicket([]byte("other secret"), &auth.Identity{UID: 7, ExpireAt: expire})
+	if err != nil {
+		t.Fatalf("issue: %v", err)
+	}
+	for name, tc := range map[string]struct {
+		ticket string
+		want   error
+	}{
+		"missing":         {"", auth.ErrMissingToken},
+		"no signature":    {encoded, auth.ErrInvalidTicket},
+		"bad signature":   {encoded + "." + base64.RawURLEncoding.EncodeToString([]byte("bad")), auth.ErrInvalidTicket},
+		"malformed":       {encoded + ".%%%", auth.ErrInvalidTicket},
+		"other secret":    {otherSecret, auth.ErrInvalidTicket},
+		"rebound room":    {rebound, auth.ErrInvalidTicket},
+		"no uid":          {issue(t, &auth.Identity{ExpireAt: expire}), auth.ErrInvalidTicket},
+		"expired":         {issue(t, &auth.Identity{UID: 7, ExpireAt: time.Now().Add(-time.Second)}), auth.ErrTicketExpired},
+		"wrong node":      {issue(t, &auth.Identity{UID: 7, NodeID: "node-2", ExpireAt: expire}), auth.ErrWrongNode},
+		"bad payload":     {signed("not json"), auth.ErrInvalidTicket},
+		"truncated token": {valid[:len(valid)-2], auth.ErrInvalidTicket},
+	} {
+		if _, err := a.Authenticate(tc.ticket); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", name, err, tc.want)
+		}
+	}
+}
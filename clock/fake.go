@@ -0,0 +1,131 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake 手动推进的时钟，定时器只在 Advance/Set 时触发
+type Fake struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+	seq    uint64
+}
+
+func NewFake(now time.Time) *Fake {
+	return &Fake{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance 推进时间，触发所有到期的定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set 设置当前时间，触发所有到期的定时器，不允许回退
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if now.Before(f.now) {
+		return
+	}
+	f.now = now
+	for t := range f.timers {
+		if t.at.After(now) {
+			continue
+		}
+		delete(f.timers, t)
+		// 和 time.Timer 一样，上一次触发未被读取时丢弃本次
+		select {
+		case t.c <- now:
+		default:
+		}
+	}
+}
+
+// Step 推进到最早到期的定时器并只触发这一个，没有不晚于 until 的定时器时返回 false
+// 多个定时器同时到期时按 Reset 的先后顺序触发，逐个 Step 可以让同一时刻的定时器按确定的顺序执行
+func (f *Fake) Step(until time.Time) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var next *fakeTimer
+	for t := range f.timers {
+		if next == nil || t.at.Before(next.at) || (t.at.Equal(next.at) && t.seq < next.seq) {
+			next = t
+		}
+	}
+	if next == nil || next.at.After(until) {
+		return false
+	}
+	if next.at.After(f.now) {
+		f.now = next.at
+	}
+	delete(f.timers, next)
+	select {
+	case next.c <- f.now:
+	default:
+	}
+	return true
+}
+
+// Pending 等待触发的定时器数量
+func (f *Fake) Pending() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.timers)
+}
+
+type fakeTimer struct {
+	f   *Fake
+	c   chan time.Time
+	at  time.Time
+	seq uint64
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	_, active := t.f.timers[t]
+	// 丢弃未读取的触发，避免 Reset 之后读到旧的时间
+	select {
+	case <-t.c:
+	default:
+	}
+	t.at = t.f.now.Add(d)
+	t.f.seq++
+	t.seq = t.f.seq
+	if d <= 0 {
+		delete(t.f.timers, t)
+		t.c <- t.f.now
+		return active
+	}
+	t.f.timers[t] = struct{}{}
+	return active
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	_, active := t.f.timers[t]
+	delete(t.f.timers, t)
+	return active
+}
@@ -1,30 +1,54 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"game_actor/match"
 	"game_actor/node"
 	"game_actor/room"
+	"game_actor/snapshot"
 	"log"
+	"time"
 )
 
 func main() {
 	port := flag.Int("port", 8080, "server port")
+	tcpPort := flag.Int("tcp-port", 0, "tcp server port, 0 to disable")
+	kcpPort := flag.Int("kcp-port", 0, "kcp (reliable udp) server port, 0 to disable")
 	nodeID := flag.String("node", "node-1", "node id")
+	ticketSecret := flag.String("ticket-secret", "", "hmac secret for client tickets, empty to disable authentication")
+	snapshotDir := flag.String("snapshot-dir", "", "directory for room snapshots, empty to disable crash recovery")
 	flag.Parse()
 
 	config := &node.GameNodeConfig{
 		NodeID:        *nodeID,
 		Host:          "127.0.0.1",
 		Port:          *port,
+		TCPPort:       *tcpPort,
+		KCPPort:       *kcpPort,
 		EtcdEndpoints: []string{}, // Empty for local test
 		ServiceName:   "game-service",
 		TTL:           10,
+		TicketSecret:  *ticketSecret,
+	}
+
+	// 房间快照，节点重启后恢复房间
+	var store snapshot.Store
+	if *snapshotDir != "" {
+		fileStore, err := snapshot.NewFileStore(*snapshotDir)
+		if err != nil {
+			log.Fatalf("Failed to open snapshot dir: %v", err)
+		}
+		store = fileStore
 	}
 
 	// Room Builder: Create a RoomActor for each room
 	builder := func(roomID int64, matchInfo *match.MatchInfo) room.GameRoom {
-		return room.NewRoomActor(roomID, matchInfo)
+		var opts []room.OptionFunc
+		if store != nil {
+			opts = append(opts, room.WithSnapshot(store, 5*time.Second))
+		}
+		return room.NewRoomActor(roomID, matchInfo, opts...)
 	}
 
 	gameNode, err := node.NewGameNode(config, builder)
@@ -32,6 +56,14 @@ func main() {
 		log.Fatalf("Failed to create game node: %v", err)
 	}
 
+	if store != nil {
+		restored, err := gameNode.GetRoomService().RestoreRooms(context.Background(), store)
+		if err != nil {
+			log.Printf("Failed to restore some rooms: %v", err)
+		}
+		log.Printf("Restored %d rooms from snapshots", len(restored))
+	}
+
 	// Create a demo room for testing
 	demoMatchInfo := &match.MatchInfo{
 		MaxPlayerWaitTime: 60,
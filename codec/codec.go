@@ -0,0 +1,93 @@
+package codec
+
+import (
+	"game_actor/session"
+	"sort"
+	"sync"
+)
+
+// Envelope 客户端和服务端之间通用的消息信封
+type Envelope struct {
+	// 请求序号，回包原样带回
+	Seq uint32
+	// 消息 ID，和 Route 二选一用于路由
+	MsgID uint32
+	// 路由名，如 "enter"、"leave"
+	Route  string
+	RoomID int64
+	UID    int64
+	// 处理失败时的错误信息
+	Error string
+	// 业务数据，由同一个 Codec 的 Marshal 编码
+	Payload []byte
+}
+
+// Codec 负责信封和业务数据的编解码
+type Codec interface {
+	// 编解码名，同时用作握手时的 query 参数和 websocket 子协议
+	Name() string
+	Encode(env *Envelope) ([]byte, error)
+	Decode(data []byte) (*Envelope, error)
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+// Binary 编码结果为二进制的 Codec 实现该接口，网络层据此选择 websocket 帧类型
+type Binary interface {
+	Binary() bool
+}
+
+// IsBinary 判断 Codec 的编码结果是否为二进制
+func IsBinary(c Codec) bool {
+	b, ok := c.(Binary)
+	return ok && b.Binary()
+}
+
+// Carrier 持有连接级 Codec 的 session
+type Carrier interface {
+	Codec() Codec
+}
+
+var (
+	mu     sync.RWMutex
+	codecs = make(map[string]Codec)
+)
+
+func init() {
+	Register(JSON)
+	Register(Proto)
+}
+
+// Register 注册 Codec，同名覆盖
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[c.Name()] = c
+}
+
+func Get(name string) (Codec, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
+
+// Names 已注册的 Codec 名，用于 websocket 子协议协商
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(codecs))
+	for name := range codecs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// FromSession 获取连接使用的 Codec，未协商的连接使用 JSON
+func FromSession(sess session.Session) Codec {
+	if c, ok := sess.(Carrier); ok && c.Codec() != nil {
+		return c.Codec()
+	}
+	return JSON
+}
@@ -0,0 +1,58 @@
+package codec
+
+import "encoding/json"
+
+// JSON 默认编解码，兼容原有的 {"action": "enter", "room_id": 1, "data": {...}} 格式
+var JSON Codec = jsonCodec{}
+
+type jsonEnvelope struct {
+	Seq    uint32          `json:"seq,omitempty"`
+	MsgID  uint32          `json:"msg_id,omitempty"`
+	Route  string          `json:"action,omitempty"`
+	RoomID int64           `json:"room_id,omitempty"`
+	UID    int64           `json:"uid,omitempty"`
+	Error  string          `json:"error,omitempty"`
+	Data   json.RawMessage `json:"data,omitempty"`
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+func (jsonCodec) Encode(env *Envelope) ([]byte, error) {
+	return json.Marshal(&jsonEnvelope{
+		Seq:    env.Seq,
+		MsgID:  env.MsgID,
+		Route:  env.Route,
+		RoomID: env.RoomID,
+		UID:    env.UID,
+		Error:  env.Error,
+		Data:   env.Payload,
+	})
+}
+
+func (jsonCodec) Decode(data []byte) (*Envelope, error) {
+	var env jsonEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		Seq:     env.Seq,
+		MsgID:   env.MsgID,
+		Route:   env.Route,
+		RoomID:  env.RoomID,
+		UID:     env.UID,
+		Error:   env.Error,
+		Payload: env.Data,
+	}, nil
+}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Proto protobuf 编解码，信封格式见 envelope.proto，业务数据必须是 proto.Message
+var Proto Codec = protoCodec{}
+
+// 信封字段编号，和 envelope.proto 保持一致
+const (
+	fieldSeq     protowire.Number = 1
+	fieldMsgID   protowire.Number = 2
+	fieldRoute   protowire.Number = 3
+	fieldRoomID  protowire.Number = 4
+	fieldUID     protowire.Number = 5
+	fieldError   protowire.Number = 6
+	fieldPayload protowire.Number = 7
+)
+
+var errNotProtoMessage = errors.New("proto codec: value is not a proto.Message")
+
+// WireMarshaler 不依赖生成代码的消息，自己按 protobuf wire 格式编码
+// 用于框架内置的推送事件（如迁移通知），字段定义见 envelope.proto
+type WireMarshaler interface {
+	MarshalWire() []byte
+}
+
+type protoCodec struct{}
+
+func (protoCodec) Name() string {
+	return "proto"
+}
+
+func (protoCodec) Binary() bool {
+	return true
+}
+
+func (protoCodec) Encode(env *Envelope) ([]byte, error) {
+	var b []byte
+	if env.Seq != 0 {
+		b = protowire.AppendTag(b, fieldSeq, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(env.Seq))
+	}
+	if env.MsgID != 0 {
+		b = protowire.AppendTag(b, fieldMsgID, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(env.MsgID))
+	}
+	if env.Route != "" {
+		b = protowire.AppendTag(b, fieldRoute, protowire.BytesType)
+		b = protowire.AppendString(b, env.Route)
+	}
+	if env.RoomID != 0 {
+		b = protowire.AppendTag(b, fieldRoomID, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(env.RoomID))
+	}
+	if env.UID != 0 {
+		b = protowire.AppendTag(b, fieldUID, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(env.UID))
+	}
+	if env.Error != "" {
+		b = protowire.AppendTag(b, fieldError, protowire.BytesType)
+		b = protowire.AppendString(b, env.Error)
+	}
+	if len(env.Payload) > 0 {
+		b = protowire.AppendTag(b, fieldPayload, protowire.BytesType)
+		b = protowire.AppendBytes(b, env.Payload)
+	}
+	return b, nil
+}
+
+func (protoCodec) Decode(data []byte) (*Envelope, error) {
+	env := new(Envelope)
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+
+		switch typ {
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case fieldSeq:
+				env.Seq = uint32(v)
+			case fieldMsgID:
+				env.MsgID = uint32(v)
+			case fieldRoomID:
+				env.RoomID = int64(v)
+			case fieldUID:
+				env.UID = int64(v)
+			}
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			data = data[n:]
+			switch num {
+			case fieldRoute:
+				env.Route = string(v)
+			case fieldError:
+				env.Error = string(v)
+			case fieldPayload:
+				env.Payload = append([]byte(nil), v...)
+			}
+		default:
+			// 未知字段直接跳过，便于协议向前兼容
+			n := protowire.ConsumeFieldValue(num, typ, data)
+			if n < 0 {
+				return nil, fmt.Errorf("proto codec: invalid field %d: %w", num, protowire.ParseError(n))
+			}
+			data = data[n:]
+		}
+	}
+	return env, nil
+}
+
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	if w, ok := v.(WireMarshaler); ok {
+		return w.MarshalWire(), nil
+	}
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, errNotProtoMessage
+	}
+	return proto.Marshal(m)
+}
+
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errNotProtoMessage
+	}
+	return proto.Unmarshal(data, m)
+}
@@ -0,0 +1,83 @@
+package codec_test
+
+import (
+	"game_actor/codec"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func fullEnvelope() *codec.Envelope {
+	return &codec.Envelope{
+		Seq:     3,
+		MsgID:   1001,
+		Route:   "enter",
+		RoomID:  1 << 40,
+		UID:     -1,
+		Error:   "room full",
+		Payload: []byte{0, 1, 2},
+	}
+}
+
+func TestProtoRoundTrip(t *testing.T) {
+	for _, env := range []*codec.Envelope{fullEnvelope(), {}} {
+		data, err := codec.Proto.Encode(env)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		got, err := codec.Proto.Decode(data)
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if !reflect.DeepEqual(got, env) {
+			t.Fatalf("got %+v, want %+v", got, env)
+		}
+	}
+}
+
+// 未知字段跳过，新版本客户端增加的字段不影响旧版本服务端
+func TestProtoUnknownFields(t *testing.T) {
+	data, _ := codec.Proto.Encode(&codec.Envelope{Route: "enter"})
+	data = protowire.AppendTag(data, 20, protowire.Fixed32Type)
+	data = protowire.AppendFixed32(data, 1)
+	data = protowire.AppendTag(data, 21, protowire.VarintType)
+	data = protowire.AppendVarint(data, 1)
+	data = protowire.AppendTag(data, 22, protowire.BytesType)
+	data = protowire.AppendString(data, "x")
+	env, err := codec.Proto.Decode(data)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if env.Route != "enter" {
+		t.Fatalf("got %+v", env)
+	}
+}
+
+// 截断或格式错误的输入返回错误，不能 panic
+func TestProtoMalformed(t *testing.T) {
+	data, _ := codec.Proto.Encode(fullEnvelope())
+	// 在字段中间截断
+	for _, n := range []int{1, 3, len(data) - 1} {
+		if _, err := codec.Proto.Decode(data[:n]); err == nil {
+			t.Errorf("decoded input truncated to %d bytes", n)
+		}
+	}
+	// 任意位置截断都不能 panic
+	for n := range data {
+		codec.Proto.Decode(data[:n])
+	}
+
+	for name, input := range map[string][]byte{
+		"field zero":      protowire.AppendVarint(nil, 0),
+		"overlong varint": append(protowire.AppendTag(nil, 1, protowire.VarintType), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01),
+		"bytes too long":  protowire.AppendVarint(protowire.AppendTag(nil, 7, protowire.BytesType), 100),
+		"open group":      protowire.AppendTag(nil, 20, protowire.StartGroupType),
+		"reserved type":   protowire.AppendVarint(nil, uint64(20)<<3|6),
+		"short fixed64":   append(protowire.AppendTag(nil, 20, protowire.Fixed64Type), 1, 2),
+	} {
+		if env, err := codec.Proto.Decode(input); err == nil {
+			t.Errorf("%s: decoded %+v", name, env)
+		}
+	}
+}
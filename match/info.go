@@ -18,6 +18,8 @@ type MatchInfo struct {
 	MaxPlayerWaitTime int32
 	// 游戏最长时间
 	MaxGameTime int32
+	// 断线重连保留座位时间（秒），0 表示断线立即离开房间
+	ReconnectGraceTime int32
 }
 
 // 游戏玩家
@@ -0,0 +1,364 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// KCP 风格的 ARQ 实现，只保留可靠有序传输需要的部分（选择重传、快速重传、滑动窗口），不做拥塞控制
+
+const (
+	arqCmdPush = 81 // 数据
+	arqCmdAck  = 82 // 确认
+
+	arqOverhead  = 20 // cmd(1) frg(1) wnd(2) ts(4) sn(4) una(4) len(4)
+	arqRtoMin    = 30
+	arqRtoNoDly  = 10
+	arqRtoDef    = 200
+	arqRtoMax    = 60000
+	arqDeadLink  = 20 // 单个分片重传超过该次数认为链路断开
+	arqFastLimit = 5  // 重传次数超过该值后不再快速重传，只依赖超时重传
+	arqMaxFrgNum = 255
+)
+
+var errMessageTooLarge = errors.New("message too large")
+
+type arqSegment struct {
+	cmd      uint8
+	frg      uint8
+	wnd      uint16
+	ts       uint32
+	sn       uint32
+	una      uint32
+	data     []byte
+	resendts uint32
+	rto      uint32
+	fastack  uint32
+	xmit     uint32
+}
+
+func (seg *arqSegment) encode(buf []byte) []byte {
+	buf = append(buf, seg.cmd, seg.frg)
+	buf = binary.LittleEndian.AppendUint16(buf, seg.wnd)
+	buf = binary.LittleEndian.AppendUint32(buf, seg.ts)
+	buf = binary.LittleEndian.AppendUint32(buf, seg.sn)
+	buf = binary.LittleEndian.AppendUint32(buf, seg.una)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(seg.data)))
+	return append(buf, seg.data...)
+}
+
+type arqAck struct {
+	sn uint32
+	ts uint32
+}
+
+// arq 非线程安全，由 kcpSession 加锁访问
+type arq struct {
+	mss      int
+	mtu      int
+	sndWnd   uint16
+	rcvWnd   uint16
+	rmtWnd   uint16
+	sndUna   uint32
+	sndNxt   uint32
+	rcvNxt   uint32
+	srtt     int32
+	rttvar   int32
+	rto      uint32
+	minRto   uint32
+	interval uint32
+	resend   uint32
+	nodelay  bool
+	dead     bool
+
+	sndQueue []*arqSegment
+	sndBuf   []*arqSegment
+	rcvBuf   []*arqSegment
+	rcvQueue []*arqSegment
+	acks     []arqAck
+	buffer   []byte
+
+	// output 把打包好的 ARQ 数据交给下层发送
+	output func(data []byte)
+}
+
+func newARQ(cfg KCPConfig, output func(data []byte)) *arq {
+	a := &arq{
+		mtu:      cfg.MTU,
+		mss:      cfg.MTU - arqOverhead,
+		sndWnd:   uint16(cfg.SndWnd),
+		rcvWnd:   uint16(cfg.RcvWnd),
+		rmtWnd:   uint16(cfg.RcvWnd),
+		rto:      arqRtoDef,
+		minRto:   arqRtoMin,
+		interval: uint32(cfg.Interval.Milliseconds()),
+		resend:   uint32(cfg.Resend),
+		nodelay:  cfg.NoDelay,
+		output:   output,
+	}
+	if a.nodelay {
+		a.minRto = arqRtoNoDly
+	}
+	return a
+}
+
+// send 把消息拆成分片放入发送队列，frg 从大到小，最后一片为 0
+// 接收方要在接收队列中凑齐所有分片才能交付，分片数必须小于接收窗口（两端使用相同的配置），否则连接会卡住
+func (a *arq) send(msg []byte) error {
+	count := (len(msg) + a.mss - 1) / a.mss
+	if count == 0 {
+		count = 1
+	}
+	if count > arqMaxFrgNum || count >= int(a.rcvWnd) {
+		return errMessageTooLarge
+	}
+	for i := 0; i < count; i++ {
+		size := min(a.mss, len(msg))
+		seg := &arqSegment{
+			frg:  uint8(count - i - 1),
+			data: append([]byte(nil), msg[:size]...),
+		}
+		a.sndQueue = append(a.sndQueue, seg)
+		msg = msg[size:]
+	}
+	return nil
+}
+
+// recv 取出一条完整的消息，没有完整消息时返回 nil
+func (a *arq) recv() []byte {
+	if len(a.rcvQueue) == 0 {
+		return nil
+	}
+	count := int(a.rcvQueue[0].frg) + 1
+	if len(a.rcvQueue) < count {
+		return nil
+	}
+	var msg []byte
+	for _, seg := range a.rcvQueue[:count] {
+		msg = append(msg, seg.data...)
+	}
+	a.rcvQueue = a.rcvQueue[count:]
+	a.moveRcvBuf()
+	return msg
+}
+
+// input 处理对端发来的 ARQ 数据
+func (a *arq) input(data []byte, now uint32) error {
+	var maxAck, maxAckTs uint32
+	var hasAck bool
+	for len(data) >= arqOverhead {
+		seg := &arqSegment{
+			cmd: data[0],
+			frg: data[1],
+			wnd: binary.LittleEndian.Uint16(data[2:]),
+			ts:  binary.LittleEndian.Uint32(data[4:]),
+			sn:  binary.LittleEndian.Uint32(data[8:]),
+			una: binary.LittleEndian.Uint32(data[12:]),
+		}
+		n := int(binary.LittleEndian.Uint32(data[16:]))
+		data = data[arqOverhead:]
+		if n > len(data) {
+			return errors.New("arq: incomplete segment")
+		}
+
+		a.rmtWnd = seg.wnd
+		a.parseUna(seg.una)
+
+		switch seg.cmd {
+		case arqCmdAck:
+			if diff(now, seg.ts) >= 0 {
+				a.updateRTT(diff(now, seg.ts))
+			}
+			a.parseAck(seg.sn)
+			if !hasAck || diff(seg.sn, maxAck) > 0 {
+				maxAck, maxAckTs, hasAck = seg.sn, seg.ts, true
+			}
+		case arqCmdPush:
+			if diff(seg.sn, a.rcvNxt+uint32(a.rcvWnd)) < 0 {
+				a.acks = append(a.acks, arqAck{sn: seg.sn, ts: seg.ts})
+				if diff(seg.sn, a.rcvNxt) >= 0 {
+					seg.data = append([]byte(nil), data[:n]...)
+					a.insertRcvBuf(seg)
+				}
+			}
+		default:
+			return errors.New("arq: unknown command")
+		}
+		data = data[n:]
+	}
+	if hasAck {
+		// 比 maxAck 小、并且在 maxAck 之前发出但还没被确认的分片，累计被跳过的次数用于快速重传
+		for _, seg := range a.sndBuf {
+			if diff(seg.sn, maxAck) < 0 && diff(maxAckTs, seg.ts) >= 0 {
+				seg.fastack++
+			}
+		}
+	}
+	return nil
+}
+
+// flush 发送 ack、新数据和需要重传的数据
+func (a *arq) flush(now uint32) {
+	wnd := a.unusedWnd()
+	for _, ack := range a.acks {
+		a.write(&arqSegment{cmd: arqCmdAck, wnd: wnd, ts: ack.ts, sn: ack.sn, una: a.rcvNxt})
+	}
+	a.acks = a.acks[:0]
+
+	// 发送窗口内的数据从 sndQueue 移到 sndBuf
+	// 对端窗口为 0 时仍保留 1 个分片作为探测，避免双方互相等待
+	cwnd := max(min(a.sndWnd, a.rmtWnd), 1)
+	for len(a.sndQueue) > 0 && diff(a.sndNxt, a.sndUna+uint32(cwnd)) < 0 {
+		seg := a.sndQueue[0]
+		a.sndQueue = a.sndQueue[1:]
+		seg.cmd = arqCmdPush
+		seg.sn = a.sndNxt
+		a.sndNxt++
+		a.sndBuf = append(a.sndBuf, seg)
+	}
+
+	for _, seg := range a.sndBuf {
+		needSend := false
+		switch {
+		case seg.xmit == 0:
+			needSend = true
+			seg.rto = a.rto
+			seg.resendts = now + seg.rto
+		case diff(now, seg.resendts) >= 0:
+			// 超时重传，nodelay 模式下 rto 增长 1.5 倍而不是翻倍
+			needSend = true
+			if a.nodelay {
+				seg.rto += seg.rto / 2
+			} else {
+				seg.rto += seg.rto
+			}
+			seg.rto = min(seg.rto, arqRtoMax)
+			seg.resendts = now + seg.rto
+		case a.resend > 0 && seg.fastack >= a.resend && seg.xmit <= arqFastLimit:
+			needSend = true
+			seg.fastack = 0
+			seg.resendts = now + seg.rto
+		}
+		if !needSend {
+			continue
+		}
+		seg.xmit++
+		seg.ts = now
+		seg.wnd = wnd
+		seg.una = a.rcvNxt
+		a.write(seg)
+		if seg.xmit >= arqDeadLink {
+			a.dead = true
+		}
+	}
+	a.flushBuffer()
+}
+
+// write 把分片追加到待发送缓冲，超过 mtu 先发出去
+func (a *arq) write(seg *arqSegment) {
+	if len(a.buffer)+arqOverhead+len(seg.data) > a.mtu {
+		a.flushBuffer()
+	}
+	a.buffer = seg.encode(a.buffer)
+}
+
+func (a *arq) flushBuffer() {
+	if len(a.buffer) == 0 {
+		return
+	}
+	a.output(a.buffer)
+	a.buffer = a.buffer[:0]
+}
+
+func (a *arq) parseUna(una uint32) {
+	i := 0
+	for i < len(a.sndBuf) && diff(a.sndBuf[i].sn, una) < 0 {
+		i++
+	}
+	a.sndBuf = a.sndBuf[i:]
+	a.shrinkSndUna()
+}
+
+func (a *arq) parseAck(sn uint32) {
+	for i, seg := range a.sndBuf {
+		if seg.sn == sn {
+			a.sndBuf = append(a.sndBuf[:i], a.sndBuf[i+1:]...)
+			break
+		}
+		if diff(seg.sn, sn) > 0 {
+			break
+		}
+	}
+	a.shrinkSndUna()
+}
+
+func (a *arq) shrinkSndUna() {
+	if len(a.sndBuf) > 0 {
+		a.sndUna = a.sndBuf[0].sn
+	} else {
+		a.sndUna = a.sndNxt
+	}
+}
+
+func (a *arq) insertRcvBuf(seg *arqSegment) {
+	i := len(a.rcvBuf)
+	for i > 0 {
+		d := diff(a.rcvBuf[i-1].sn, seg.sn)
+		if d == 0 {
+			return // 重复的分片
+		}
+		if d < 0 {
+			break
+		}
+		i--
+	}
+	a.rcvBuf = append(a.rcvBuf, nil)
+	copy(a.rcvBuf[i+1:], a.rcvBuf[i:])
+	a.rcvBuf[i] = seg
+	a.moveRcvBuf()
+}
+
+// moveRcvBuf 把连续的分片从 rcvBuf 移到 rcvQueue
+func (a *arq) moveRcvBuf() {
+	for len(a.rcvBuf) > 0 && a.rcvBuf[0].sn == a.rcvNxt && len(a.rcvQueue) < int(a.rcvWnd) {
+		a.rcvQueue = append(a.rcvQueue, a.rcvBuf[0])
+		a.rcvBuf = a.rcvBuf[1:]
+		a.rcvNxt++
+	}
+}
+
+func (a *arq) updateRTT(rtt int32) {
+	if a.srtt == 0 {
+		a.srtt = rtt
+		a.rttvar = rtt / 2
+	} else {
+		delta := rtt - a.srtt
+		if delta < 0 {
+			delta = -delta
+		}
+		a.rttvar = (3*a.rttvar + delta) / 4
+		a.srtt = (7*a.srtt + rtt) / 8
+		if a.srtt < 1 {
+			a.srtt = 1
+		}
+	}
+	rto := uint32(a.srtt) + max(a.interval, uint32(4*a.rttvar))
+	a.rto = min(max(rto, a.minRto), arqRtoMax)
+}
+
+func (a *arq) unusedWnd() uint16 {
+	if len(a.rcvQueue) < int(a.rcvWnd) {
+		return a.rcvWnd - uint16(len(a.rcvQueue))
+	}
+	return 0
+}
+
+// waitSnd 还没被确认的分片数
+func (a *arq) waitSnd() int {
+	return len(a.sndBuf) + len(a.sndQueue)
+}
+
+// diff 处理序号和时间戳回绕
+func diff(later, earlier uint32) int32 {
+	return int32(later - earlier)
+}
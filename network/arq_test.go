@@ -0,0 +1,304 @@
+package network
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// arqPeer 记录 arq 输出的 UDP 包，由测试决定丢弃、乱序还是重复投递
+type arqPeer struct {
+	a   *arq
+	out [][]byte
+}
+
+func newARQPeer(cfg KCPConfig) *arqPeer {
+	p := &arqPeer{}
+	p.a = newARQ(cfg, func(data []byte) {
+		// arq 会复用 buffer，需要复制
+		p.out = append(p.out, append([]byte(nil), data...))
+	})
+	return p
+}
+
+// take 取出已经输出的包，拆成单个分片，便于逐个丢弃或调整顺序
+func (p *arqPeer) take() [][]byte {
+	var segs [][]byte
+	for _, pkt := range p.out {
+		for len(pkt) >= arqOverhead {
+			n := arqOverhead + int(binary.LittleEndian.Uint32(pkt[16:]))
+			segs = append(segs, pkt[:n])
+			pkt = pkt[n:]
+		}
+	}
+	p.out = nil
+	return segs
+}
+
+func (p *arqPeer) input(t *testing.T, segs [][]byte, now uint32) {
+	t.Helper()
+	for _, seg := range segs {
+		if err := p.a.input(seg, now); err != nil {
+			t.Fatalf("input: %v", err)
+		}
+	}
+}
+
+func (p *arqPeer) recvAll() [][]byte {
+	var msgs [][]byte
+	for msg := p.a.recv(); msg != nil; msg = p.a.recv() {
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func segCmd(seg []byte) uint8 {
+	return seg[0]
+}
+
+func segSN(seg []byte) uint32 {
+	return binary.LittleEndian.Uint32(seg[8:])
+}
+
+func testARQConfig() KCPConfig {
+	return KCPConfig{
+		NoDelay:  true,
+		Interval: 10 * time.Millisecond,
+		Resend:   2,
+		SndWnd:   32,
+		RcvWnd:   32,
+		MTU:      100,
+	}
+}
+
+func sendAll(t *testing.T, p *arqPeer, msgs ...[]byte) {
+	t.Helper()
+	for _, msg := range msgs {
+		if err := p.a.send(msg); err != nil {
+			t.Fatalf("send: %v", err)
+		}
+	}
+}
+
+func assertMessages(t *testing.T, got [][]byte, want ...[]byte) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !bytes.Equal(got[i], want[i]) {
+			t.Fatalf("message %d: got %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+// 分片乱序到达，接收方按发送顺序交付并重组大消息
+func TestARQOrdering(t *testing.T) {
+	cfg := testARQConfig()
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	big := bytes.Repeat([]byte("0123456789"), 20) // 超过 mss，拆成 3 个分片
+	sendAll(t, s, []byte("a"), big, []byte("c"))
+	s.a.flush(0)
+
+	segs := s.take()
+	if len(segs) != 5 {
+		t.Fatalf("got %d segments, want 5", len(segs))
+	}
+	for i := len(segs) - 1; i > 0; i-- {
+		r.input(t, segs[i:i+1], 1)
+		if msgs := r.recvAll(); msgs != nil {
+			t.Fatalf("delivered %q before the first segment arrived", msgs)
+		}
+	}
+	r.input(t, segs[:1], 1)
+	assertMessages(t, r.recvAll(), []byte("a"), big, []byte("c"))
+}
+
+// 重复的分片只交付一次，但每次都回 ack，避免对端的 ack 丢失后一直重传
+func TestARQDuplicate(t *testing.T) {
+	cfg := testARQConfig()
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	sendAll(t, s, []byte("x"))
+	s.a.flush(0)
+	segs := s.take()
+
+	r.input(t, segs, 1)
+	r.input(t, segs, 2)
+	assertMessages(t, r.recvAll(), []byte("x"))
+
+	r.a.flush(2)
+	acks := r.take()
+	if len(acks) != 2 {
+		t.Fatalf("got %d acks, want 2", len(acks))
+	}
+	s.input(t, acks, 3)
+	if n := s.a.waitSnd(); n != 0 {
+		t.Fatalf("%d segments still waiting for ack", n)
+	}
+}
+
+// 丢包后超时重传，nodelay 模式下 rto 每次增长 1.5 倍
+func TestARQRetransmit(t *testing.T) {
+	cfg := testARQConfig()
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	sendAll(t, s, []byte("x"))
+	s.a.flush(0)
+	s.take() // 丢弃
+
+	s.a.flush(arqRtoDef - 1)
+	if segs := s.take(); len(segs) != 0 {
+		t.Fatalf("resent %d segments before rto", len(segs))
+	}
+	s.a.flush(arqRtoDef)
+	segs := s.take()
+	if len(segs) != 1 || segCmd(segs[0]) != arqCmdPush {
+		t.Fatalf("got %d segments, want 1 retransmission", len(segs))
+	}
+	if seg := s.a.sndBuf[0]; seg.xmit != 2 || seg.rto != arqRtoDef*3/2 {
+		t.Fatalf("xmit %d rto %d after retransmission", seg.xmit, seg.rto)
+	}
+
+	r.input(t, segs, arqRtoDef)
+	assertMessages(t, r.recvAll(), []byte("x"))
+	r.a.flush(arqRtoDef)
+	s.input(t, r.take(), arqRtoDef+1)
+	if n := s.a.waitSnd(); n != 0 {
+		t.Fatalf("%d segments still waiting for ack", n)
+	}
+}
+
+// 后面的分片被确认了 Resend 次之后，不等 rto 立即重传丢失的分片
+func TestARQFastRetransmit(t *testing.T) {
+	cfg := testARQConfig()
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	sendAll(t, s, []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+	s.a.flush(0)
+	segs := s.take()
+
+	r.input(t, segs[1:], 1)
+	r.a.flush(1)
+	s.input(t, r.take(), 2)
+	s.a.flush(3)
+	resent := s.take()
+	if len(resent) != 1 || segSN(resent[0]) != 0 {
+		t.Fatalf("got %d segments, want fast retransmission of sn 0", len(resent))
+	}
+
+	r.input(t, resent, 4)
+	assertMessages(t, r.recvAll(), []byte("a"), []byte("b"), []byte("c"), []byte("d"))
+}
+
+// 发送窗口限制未确认的分片数，收到 ack 后继续发送
+func TestARQSendWindow(t *testing.T) {
+	cfg := testARQConfig()
+	cfg.SndWnd = 4
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	for i := range 10 {
+		sendAll(t, s, []byte{byte(i)})
+	}
+	s.a.flush(0)
+	segs := s.take()
+	if len(segs) != 4 || segSN(segs[3]) != 3 {
+		t.Fatalf("got %d segments in the first window, want 4", len(segs))
+	}
+	s.a.flush(1)
+	if n := len(s.take()); n != 0 {
+		t.Fatalf("sent %d segments beyond the window", n)
+	}
+
+	r.input(t, segs, 2)
+	r.a.flush(2)
+	s.input(t, r.take(), 3)
+	s.a.flush(3)
+	segs = s.take()
+	if len(segs) != 4 || segSN(segs[0]) != 4 {
+		t.Fatalf("got %d segments in the second window, want sn 4-7", len(segs))
+	}
+}
+
+// 接收窗口满时丢弃窗口外的分片并通告窗口为 0，发送方停止发送新数据
+func TestARQReceiveWindow(t *testing.T) {
+	cfg := testARQConfig()
+	s := newARQPeer(cfg)
+	cfg.RcvWnd = 2
+	r := newARQPeer(cfg)
+	for i := range 6 {
+		sendAll(t, s, []byte{byte(i)})
+	}
+	s.a.flush(0)
+	// sn 0-1 进入接收队列，sn 2-3 在 rcvNxt 之后的窗口内先缓存，sn 4-5 超出窗口被丢弃
+	r.input(t, s.take(), 1)
+	r.a.flush(1)
+	acks := r.take()
+	if len(acks) != 4 {
+		t.Fatalf("got %d acks, want 4 for the segments inside the window", len(acks))
+	}
+	s.input(t, acks, 2)
+	if s.a.rmtWnd != 0 {
+		t.Fatalf("remote window %d, want 0", s.a.rmtWnd)
+	}
+
+	// 窗口外的 2 个分片仍在等待重传，新数据留在发送队列
+	sendAll(t, s, []byte("new"))
+	s.a.flush(3)
+	if len(s.a.sndBuf) != 2 || len(s.a.sndQueue) != 1 {
+		t.Fatalf("%d in flight, %d queued; want 2 and 1", len(s.a.sndBuf), len(s.a.sndQueue))
+	}
+
+	// 应用读走数据后窗口重新打开
+	assertMessages(t, r.recvAll(), []byte{0}, []byte{1}, []byte{2}, []byte{3})
+	if wnd := r.a.unusedWnd(); wnd != 2 {
+		t.Fatalf("receive window %d after recv, want 2", wnd)
+	}
+}
+
+// 一直收不到 ack 时重传次数达到上限，认为链路断开
+func TestARQDeadLink(t *testing.T) {
+	s := newARQPeer(testARQConfig())
+	sendAll(t, s, []byte("x"))
+	var now uint32
+	for i := 0; i < arqDeadLink && !s.a.dead; i++ {
+		s.a.flush(now)
+		now += arqRtoMax
+	}
+	if !s.a.dead {
+		t.Fatal("link not marked dead")
+	}
+	if xmit := s.a.sndBuf[0].xmit; xmit != arqDeadLink {
+		t.Fatalf("xmit %d, want %d", xmit, arqDeadLink)
+	}
+}
+
+// 分片数达到接收窗口的消息永远无法在接收方凑齐，发送时直接拒绝；窗口内最大的消息可以正常收发
+func TestARQMessageTooLarge(t *testing.T) {
+	cfg := testARQConfig()
+	s, r := newARQPeer(cfg), newARQPeer(cfg)
+	mss := cfg.MTU - arqOverhead
+	if err := s.a.send(make([]byte, (cfg.RcvWnd-1)*mss+1)); err != errMessageTooLarge {
+		t.Fatalf("send %d fragments: got %v, want errMessageTooLarge", cfg.RcvWnd, err)
+	}
+	big := bytes.Repeat([]byte{7}, (cfg.RcvWnd-1)*mss)
+	sendAll(t, s, big)
+	s.a.flush(0)
+	r.input(t, s.take(), 1)
+	assertMessages(t, r.recvAll(), big)
+}
+
+func TestKCPConfigValidate(t *testing.T) {
+	if err := DefaultKCPConfig().Validate(); err != nil {
+		t.Fatalf("default config: %v", err)
+	}
+	for name, modify := range map[string]func(c *KCPConfig){
+		"mtu":      func(c *KCPConfig) { c.MTU = arqOverhead },
+		"rcv wnd":  func(c *KCPConfig) { c.RcvWnd = 0 },
+		"snd wnd":  func(c *KCPConfig) { c.SndWnd = 1 << 16 },
+		"interval": func(c *KCPConfig) { c.Interval = 0 },
+	} {
+		cfg := DefaultKCPConfig()
+		modify(&cfg)
+		if err := cfg.Validate(); err == nil {
+			t.Fatalf("%s: invalid config accepted", name)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package network
+
+import (
+	"game_actor/auth"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// 使用首条消息鉴权时，连接建立后必须在该时间内发送凭证
+const authTimeout = 10 * time.Second
+
+// tokenFromRequest 按 sources 从握手请求中读取凭证
+func tokenFromRequest(r *http.Request, sources auth.Source) string {
+	if sources&auth.SourceQuery != 0 {
+		if token := r.URL.Query().Get("ticket"); token != "" {
+			return token
+		}
+	}
+	if sources&auth.SourceHeader != 0 {
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok && token != "" {
+			return token
+		}
+		if token := r.Header.Get("X-Ticket"); token != "" {
+			return token
+		}
+	}
+	return ""
+}
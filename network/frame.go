@@ -0,0 +1,33 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// 长度前缀为 4 字节大端无符号整数
+const frameHeaderSize = 4
+
+// appendFrame 以 [len][payload] 的格式追加一条消息
+func appendFrame(buf []byte, msg []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(msg)))
+	return append(buf, msg...)
+}
+
+// SplitFrames 拆分长度前缀格式的批量消息，供客户端或测试使用
+func SplitFrames(data []byte) ([][]byte, error) {
+	var msgs [][]byte
+	for len(data) > 0 {
+		if len(data) < frameHeaderSize {
+			return nil, errors.New("incomplete frame header")
+		}
+		n := int(binary.BigEndian.Uint32(data))
+		data = data[frameHeaderSize:]
+		if n > len(data) {
+			return nil, errors.New("incomplete frame payload")
+		}
+		msgs = append(msgs, data[:n])
+		data = data[n:]
+	}
+	return msgs, nil
+}
@@ -0,0 +1,106 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"game_actor/codec"
+	"game_actor/session"
+	"net"
+	"time"
+)
+
+const (
+	kcpHandshakeRetry    = 200 * time.Millisecond
+	kcpHandshakeAttempts = 10
+)
+
+// DialKCP 连接 KCPServer 并完成握手，用于机器人和测试客户端
+// handler 在独立的 goroutine 中按接收顺序调用
+func DialKCP(addr string, token []byte, config KCPConfig, handler func(sess session.Session, msg []byte)) (session.Session, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, udpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	conv, err := kcpHandshake(conn, token)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	sess := newKCPSession(conv, config, codec.JSON, func(data []byte) error {
+		_, err := conn.Write(data)
+		return err
+	})
+	sess.addr = udpAddr
+	sess.onClose = func() {
+		conn.Close()
+	}
+	sess.run(handler, nil, nil)
+
+	go func() {
+		buf := make([]byte, kcpReadBufferSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				sess.closeLocal()
+				return
+			}
+			if n < kcpHeaderSize || binary.BigEndian.Uint32(buf[1:]) != conv {
+				continue
+			}
+			switch buf[0] {
+			case kcpPktARQ:
+				sess.input(buf[kcpHeaderSize:n])
+			case kcpPktUnreliable:
+				sess.touch()
+				sess.deliver(append([]byte(nil), buf[kcpHeaderSize:n]...), false)
+			case kcpPktClose:
+				sess.closeLocal()
+				return
+			}
+		}
+	}()
+	return sess, nil
+}
+
+// kcpHandshake 发送握手并等待服务端分配 conv，超时未应答则重发
+func kcpHandshake(conn *net.UDPConn, token []byte) (uint32, error) {
+	var b [4]byte
+	rand.Read(b[:])
+	nonce := binary.BigEndian.Uint32(b[:])
+	req := append(kcpHeader(kcpPktHandshake, nonce), token...)
+
+	buf := make([]byte, kcpReadBufferSize)
+	for i := 0; i < kcpHandshakeAttempts; i++ {
+		if _, err := conn.Write(req); err != nil {
+			return 0, err
+		}
+		conn.SetReadDeadline(time.Now().Add(kcpHandshakeRetry))
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break
+			}
+			if n < kcpHeaderSize || binary.BigEndian.Uint32(buf[1:]) != nonce {
+				continue
+			}
+			switch {
+			case buf[0] == kcpPktHandshakeAck && n >= kcpHeaderSize+4:
+				conn.SetReadDeadline(time.Time{})
+				return binary.BigEndian.Uint32(buf[kcpHeaderSize:]), nil
+			case buf[0] == kcpPktReject:
+				return 0, errors.New("handshake rejected: " + string(buf[kcpHeaderSize:n]))
+			}
+		}
+	}
+	return 0, errors.New("handshake timeout")
+}
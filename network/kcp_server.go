@@ -0,0 +1,494 @@
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"game_actor/auth"
+	"game_actor/codec"
+	"game_actor/session"
+	"log"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// UDP 包格式：[1 字节类型][4 字节 nonce 或 conv][数据]
+const (
+	kcpPktHandshake    = 1 // 客户端 -> 服务端：[nonce][token]
+	kcpPktHandshakeAck = 2 // 服务端 -> 客户端：[nonce][conv]
+	kcpPktReject       = 3 // 服务端 -> 客户端：[nonce][原因]
+	kcpPktARQ          = 4 // [conv][ARQ 数据]，可靠有序
+	kcpPktUnreliable   = 5 // [conv][消息]，不重传，可能丢失或乱序
+	kcpPktClose        = 6 // [conv]
+
+	kcpHeaderSize = 5
+)
+
+const (
+	// 接收缓冲区大小，超过 UDP 最大包长即可
+	kcpReadBufferSize = 64 * 1024
+	// 每个连接等待 handler 处理的消息数上限
+	kcpRecvQueueSize = 256
+)
+
+var (
+	errSessionClosed = errors.New("session closed")
+	errRecvOverflow  = errors.New("receive queue overflow")
+)
+
+// KCPConfig 可靠 UDP 传输参数
+type KCPConfig struct {
+	// 开启后使用更小的最小 RTO，超时重传 RTO 只增长 1.5 倍
+	NoDelay bool
+	// 内部刷新间隔，决定 ack 和重传的及时性
+	Interval time.Duration
+	// 被跳过多少次 ack 后立即快速重传，0 表示关闭快速重传
+	Resend int
+	// 发送和接收窗口（分片数）
+	SndWnd int
+	RcvWnd int
+	// 单个 UDP 包的最大字节数
+	MTU int
+	// 超过该时间没有收到任何数据则关闭连接
+	IdleTimeout time.Duration
+}
+
+// DefaultKCPConfig 偏向低延迟的默认参数，相当于 KCP 的极速模式
+func DefaultKCPConfig() KCPConfig {
+	return KCPConfig{
+		NoDelay:     true,
+		Interval:    10 * time.Millisecond,
+		Resend:      2,
+		SndWnd:      128,
+		RcvWnd:      128,
+		MTU:         1400,
+		IdleTimeout: 30 * time.Second,
+	}
+}
+
+// Validate 检查参数，MTU 需要能放下 ARQ 分片头，窗口不能超过 ARQ 头中的 16 位
+func (c KCPConfig) Validate() error {
+	if c.MTU <= arqOverhead+kcpHeaderSize {
+		return fmt.Errorf("kcp: mtu %d too small, need more than %d", c.MTU, arqOverhead+kcpHeaderSize)
+	}
+	if c.SndWnd <= 0 || c.SndWnd > math.MaxUint16 || c.RcvWnd <= 0 || c.RcvWnd > math.MaxUint16 {
+		return fmt.Errorf("kcp: window %d/%d out of range", c.SndWnd, c.RcvWnd)
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("kcp: interval %v must be positive", c.Interval)
+	}
+	return nil
+}
+
+// UnreliableSender 支持不可靠发送的 session，用于位置同步等可以丢弃的消息
+type UnreliableSender interface {
+	SendUnreliable(msg []byte) error
+}
+
+// KCPServer 基于 UDP 的可靠传输服务，回调接口和 WSServer 一致
+type KCPServer struct {
+	addr          string
+	config        KCPConfig
+	codec         codec.Codec
+	conn          *net.UDPConn
+	authenticator auth.Authenticator
+	handler       func(sess session.Session, msg []byte)
+	onConnect     func(sess session.Session)
+	onClose       func(sess session.Session)
+
+	mu         sync.Mutex
+	sessions   map[uint32]*kcpSession // conv -> session
+	handshakes map[string]*kcpSession // addr/nonce -> session，用于应答重发的握手包
+}
+
+func NewKCPServer(addr string, config KCPConfig) *KCPServer {
+	return &KCPServer{
+		addr:       addr,
+		config:     config,
+		codec:      codec.JSON,
+		sessions:   make(map[uint32]*kcpSession),
+		handshakes: make(map[string]*kcpSession),
+	}
+}
+
+func (s *KCPServer) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// SetAuthenticator 设置握手校验，conv 只分配给鉴权通过的握手；未设置时接受所有握手且不绑定用户
+func (s *KCPServer) SetAuthenticator(a auth.Authenticator) {
+	s.authenticator = a
+}
+
+func (s *KCPServer) SetHandler(h func(sess session.Session, msg []byte)) {
+	s.handler = h
+}
+
+func (s *KCPServer) SetOnConnect(h func(sess session.Session)) {
+	s.onConnect = h
+}
+
+func (s *KCPServer) SetOnClose(h func(sess session.Session)) {
+	s.onClose = h
+}
+
+func (s *KCPServer) Start() error {
+	if err := s.config.Validate(); err != nil {
+		return err
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return err
+	}
+	s.conn = conn
+
+	buf := make([]byte, kcpReadBufferSize)
+	for {
+		n, addr, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		if n < kcpHeaderSize {
+			continue
+		}
+		s.handlePacket(addr, buf[0], binary.BigEndian.Uint32(buf[1:]), buf[kcpHeaderSize:n])
+	}
+}
+
+func (s *KCPServer) Stop() error {
+	if s.conn == nil {
+		return nil
+	}
+	s.mu.Lock()
+	sessions := make([]*kcpSession, 0, len(s.sessions))
+	for _, sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	s.mu.Unlock()
+	for _, sess := range sessions {
+		sess.Close()
+	}
+	return s.conn.Close()
+}
+
+func (s *KCPServer) handlePacket(addr *net.UDPAddr, typ byte, id uint32, data []byte) {
+	if typ == kcpPktHandshake {
+		s.handleHandshake(addr, id, data)
+		return
+	}
+
+	s.mu.Lock()
+	sess, ok := s.sessions[id]
+	s.mu.Unlock()
+	// conv 和握手时的地址绑定，其他地址发来的包直接丢弃
+	if !ok || sess.addr.String() != addr.String() {
+		return
+	}
+	switch typ {
+	case kcpPktARQ:
+		sess.input(data)
+	case kcpPktUnreliable:
+		sess.touch()
+		sess.deliver(append([]byte(nil), data...), false)
+	case kcpPktClose:
+		sess.closeLocal()
+	}
+}
+
+func (s *KCPServer) handleHandshake(addr *net.UDPAddr, nonce uint32, token []byte) {
+	key := fmt.Sprintf("%s/%d", addr, nonce)
+
+	s.mu.Lock()
+	sess, ok := s.handshakes[key]
+	s.mu.Unlock()
+	if ok {
+		// 客户端没收到应答重发了握手，原样应答
+		s.writeHandshakeAck(addr, nonce, sess.conv)
+		return
+	}
+
+	var identity *auth.Identity
+	if s.authenticator != nil {
+		var err error
+		if identity, err = s.authenticator.Authenticate(string(token)); err != nil {
+			log.Printf("KCP handshake from %s rejected: %v", addr, err)
+			s.writeTo(addr, append(kcpHeader(kcpPktReject, nonce), err.Error()...))
+			return
+		}
+	}
+
+	s.mu.Lock()
+	conv := s.newConv()
+	sess = newKCPSession(conv, s.config, s.codec, func(data []byte) error {
+		_, err := s.conn.WriteToUDP(data, addr)
+		return err
+	})
+	sess.addr = addr
+	if identity != nil {
+		auth.Bind(sess, identity)
+	}
+	sess.onClose = func() {
+		s.mu.Lock()
+		delete(s.sessions, conv)
+		delete(s.handshakes, key)
+		s.mu.Unlock()
+	}
+	s.sessions[conv] = sess
+	s.handshakes[key] = sess
+	s.mu.Unlock()
+
+	s.writeHandshakeAck(addr, nonce, conv)
+	sess.run(s.handler, s.onConnect, s.onClose)
+}
+
+// newConv 随机分配 conv，避免被猜测，调用方持有锁
+func (s *KCPServer) newConv() uint32 {
+	var b [4]byte
+	for {
+		rand.Read(b[:])
+		conv := binary.BigEndian.Uint32(b[:])
+		if _, exists := s.sessions[conv]; conv != 0 && !exists {
+			return conv
+		}
+	}
+}
+
+func (s *KCPServer) writeHandshakeAck(addr *net.UDPAddr, nonce uint32, conv uint32) {
+	s.writeTo(addr, binary.BigEndian.AppendUint32(kcpHeader(kcpPktHandshakeAck, nonce), conv))
+}
+
+func (s *KCPServer) writeTo(addr *net.UDPAddr, data []byte) {
+	if _, err := s.conn.WriteToUDP(data, addr); err != nil {
+		log.Printf("KCP write to %s error: %v", addr, err)
+	}
+}
+
+func kcpHeader(typ byte, id uint32) []byte {
+	return binary.BigEndian.AppendUint32([]byte{typ}, id)
+}
+
+type kcpSession struct {
+	id       string
+	uid      int64
+	identity *auth.Identity
+	conv     uint32
+	addr     *net.UDPAddr
+	codec    codec.Codec
+	config   KCPConfig
+	write    func(data []byte) error
+
+	mu       sync.Mutex
+	arq      *arq
+	start    time.Time
+	lastRecv time.Time
+	closed   bool
+	// onClose 连接关闭时从服务端移除
+	onClose func()
+
+	recvChan chan []byte
+	die      chan struct{}
+}
+
+func newKCPSession(conv uint32, config KCPConfig, c codec.Codec, write func(data []byte) error) *kcpSession {
+	now := time.Now()
+	sess := &kcpSession{
+		id:       fmt.Sprintf("%d", now.UnixNano()), // Simple ID generation
+		conv:     conv,
+		codec:    c,
+		config:   config,
+		write:    write,
+		start:    now,
+		lastRecv: now,
+		recvChan: make(chan []byte, kcpRecvQueueSize),
+		die:      make(chan struct{}),
+	}
+	header := kcpHeader(kcpPktARQ, conv)
+	sess.arq = newARQ(config, func(data []byte) {
+		sess.write(append(header[:kcpHeaderSize:kcpHeaderSize], data...))
+	})
+	return sess
+}
+
+// run 启动刷新和消息处理 goroutine，handler 按接收顺序串行调用
+func (s *kcpSession) run(handler func(sess session.Session, msg []byte), onConnect, onClose func(sess session.Session)) {
+	go s.updateLoop()
+	go func() {
+		if onConnect != nil {
+			onConnect(s)
+		}
+		for {
+			select {
+			case msg := <-s.recvChan:
+				if handler != nil {
+					handler(s, msg)
+				}
+			case <-s.die:
+				if onClose != nil {
+					onClose(s)
+				}
+				return
+			}
+		}
+	}()
+}
+
+func (s *kcpSession) updateLoop() {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			s.arq.flush(s.now())
+			dead := s.arq.dead
+			idle := s.config.IdleTimeout > 0 && time.Since(s.lastRecv) > s.config.IdleTimeout
+			s.mu.Unlock()
+			if dead || idle {
+				s.Close()
+				return
+			}
+		case <-s.die:
+			return
+		}
+	}
+}
+
+func (s *kcpSession) input(data []byte) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.lastRecv = time.Now()
+	if err := s.arq.input(data, s.now()); err != nil {
+		s.mu.Unlock()
+		return
+	}
+	var msgs [][]byte
+	for msg := s.arq.recv(); msg != nil; msg = s.arq.recv() {
+		msgs = append(msgs, msg)
+	}
+	// 尽快回 ack
+	s.arq.flush(s.now())
+	s.mu.Unlock()
+
+	for _, msg := range msgs {
+		s.deliver(msg, true)
+	}
+}
+
+func (s *kcpSession) touch() {
+	s.mu.Lock()
+	s.lastRecv = time.Now()
+	s.mu.Unlock()
+}
+
+// deliver 交给 handler goroutine，在 UDP 读循环中调用，不能阻塞，否则一个处理慢的连接会拖住所有连接
+// 队列满时丢弃不可靠消息；可靠消息已经确认给对端，无法丢弃，只能关闭连接
+func (s *kcpSession) deliver(msg []byte, reliable bool) {
+	select {
+	case s.recvChan <- msg:
+	case <-s.die:
+	default:
+		if !reliable {
+			return
+		}
+		log.Printf("KCP session %s (UID: %d) closed: %v", s.id, s.uid, errRecvOverflow)
+		s.Close()
+	}
+}
+
+func (s *kcpSession) now() uint32 {
+	return uint32(time.Since(s.start).Milliseconds())
+}
+
+func (s *kcpSession) ID() string {
+	return s.id
+}
+
+func (s *kcpSession) Codec() codec.Codec {
+	return s.codec
+}
+
+func (s *kcpSession) Identity() *auth.Identity {
+	return s.identity
+}
+
+func (s *kcpSession) SetIdentity(id *auth.Identity) {
+	s.identity = id
+}
+
+func (s *kcpSession) UserID() int64 {
+	return s.uid
+}
+
+func (s *kcpSession) SetUserID(uid int64) {
+	s.uid = uid
+}
+
+func (s *kcpSession) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSessionClosed
+	}
+	// 对端长时间不确认，积压超过窗口的数倍时拒绝继续发送
+	if s.arq.waitSnd() > 4*s.config.SndWnd {
+		return errors.New("send buffer full")
+	}
+	if err := s.arq.send(msg); err != nil {
+		return err
+	}
+	s.arq.flush(s.now())
+	return nil
+}
+
+// SendUnreliable 不经过 ARQ 直接发送，超过 MTU 的消息会被拒绝
+func (s *kcpSession) SendUnreliable(msg []byte) error {
+	if len(msg)+kcpHeaderSize > s.config.MTU {
+		return errMessageTooLarge
+	}
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if closed {
+		return errSessionClosed
+	}
+	return s.write(append(kcpHeader(kcpPktUnreliable, s.conv), msg...))
+}
+
+// Close 通知对端并关闭连接
+func (s *kcpSession) Close() error {
+	s.mu.Lock()
+	closed := s.closed
+	s.mu.Unlock()
+	if !closed {
+		s.write(kcpHeader(kcpPktClose, s.conv))
+	}
+	return s.closeLocal()
+}
+
+// closeLocal 对端已经关闭，只释放本地资源
+func (s *kcpSession) closeLocal() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.die)
+	if s.onClose != nil {
+		s.onClose()
+	}
+	return nil
+}
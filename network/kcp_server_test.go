@@ -0,0 +1,28 @@
+package network
+
+import "testing"
+
+// handler 处理不过来时 deliver 不能阻塞 UDP 读循环
+func TestKCPDeliverOverflow(t *testing.T) {
+	var closed bool
+	sess := newKCPSession(1, DefaultKCPConfig(), nil, func(data []byte) error {
+		return nil
+	})
+	sess.onClose = func() {
+		closed = true
+	}
+	for range kcpRecvQueueSize {
+		sess.deliver([]byte("x"), true)
+	}
+
+	sess.deliver([]byte("unreliable"), false)
+	if closed {
+		t.Fatal("session closed after dropping an unreliable message")
+	}
+	sess.deliver([]byte("reliable"), true)
+	if !closed {
+		t.Fatal("session still open after reliable delivery overflowed")
+	}
+	// 关闭之后的投递直接返回
+	sess.deliver([]byte("late"), true)
+}
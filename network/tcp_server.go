@@ -0,0 +1,301 @@
+package network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"game_actor/auth"
+	"game_actor/codec"
+	"game_actor/session"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 单条消息的最大长度，防止恶意的长度前缀导致分配过大的内存
+const maxFrameSize = 4 << 20
+
+var errFrameTooLarge = errors.New("frame too large")
+
+// 默认读超时，TCP 没有控制帧，客户端需要在超时内发送消息或 heartbeat
+const defaultTCPReadTimeout = 60 * time.Second
+
+// 读缓冲池，处理完一条消息后归还
+var readBufPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// TCPServer 使用 [4 字节大端长度][消息] 分帧的 TCP 服务，回调接口和 WSServer 一致
+type TCPServer struct {
+	addr     string
+	codec    codec.Codec
+	mu       sync.Mutex
+	listener net.Listener
+	// Stop 之后不再监听，Start 还没有创建 listener 时由 Start 自己关闭
+	stopped bool
+	// 读超时，每收到一条消息顺延，0 表示不超时
+	readTimeout time.Duration
+	// 设置后连接的第一条消息必须是凭证
+	authenticator auth.Authenticator
+	handler       func(sess session.Session, msg []byte)
+	onConnect     func(sess session.Session)
+	onClose       func(sess session.Session)
+}
+
+func NewTCPServer(addr string) *TCPServer {
+	return &TCPServer{
+		addr:        addr,
+		codec:       codec.JSON,
+		readTimeout: defaultTCPReadTimeout,
+	}
+}
+
+func (s *TCPServer) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// SetReadTimeout 设置读超时，超时内没有收到任何消息的连接会被关闭并触发 onClose
+func (s *TCPServer) SetReadTimeout(d time.Duration) {
+	s.readTimeout = d
+}
+
+// SetAuthenticator 开启连接鉴权，TCP 连接只支持用第一条消息携带凭证
+func (s *TCPServer) SetAuthenticator(a auth.Authenticator) {
+	s.authenticator = a
+}
+
+// SetHandler msg 使用读缓冲池中的内存，只在 handler 调用期间有效，需要保留时请拷贝
+func (s *TCPServer) SetHandler(h func(sess session.Session, msg []byte)) {
+	s.handler = h
+}
+
+func (s *TCPServer) SetOnConnect(h func(sess session.Session)) {
+	s.onConnect = h
+}
+
+func (s *TCPServer) SetOnClose(h func(sess session.Session)) {
+	s.onClose = h
+}
+
+func (s *TCPServer) Start() error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		ln.Close()
+		return nil
+	}
+	s.listener = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.handleConn(conn)
+	}
+}
+
+// Stop 关闭 listener，Start 正在另一个 goroutine 中启动时也会退出
+func (s *TCPServer) Stop() error {
+	s.mu.Lock()
+	s.stopped = true
+	ln := s.listener
+	s.mu.Unlock()
+	if ln == nil {
+		return nil
+	}
+	return ln.Close()
+}
+
+func (s *TCPServer) handleConn(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+
+	var identity *auth.Identity
+	if s.authenticator != nil {
+		var err error
+		if identity, err = s.authFirstMessage(conn, reader); err != nil {
+			conn.Close()
+			return
+		}
+	}
+
+	sess := newTCPSession(conn, s.codec)
+	if identity != nil {
+		auth.Bind(sess, identity)
+	}
+
+	if s.onConnect != nil {
+		s.onConnect(sess)
+	}
+
+	defer func() {
+		sess.Close()
+		if s.onClose != nil {
+			s.onClose(sess)
+		}
+	}()
+
+	for {
+		if s.readTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+		}
+		bufPtr := readBufPool.Get().(*[]byte)
+		message, err := readFrame(reader, (*bufPtr)[:0])
+		if err != nil {
+			readBufPool.Put(bufPtr)
+			break
+		}
+		if s.handler != nil {
+			s.handler(sess, message)
+		}
+		*bufPtr = message
+		readBufPool.Put(bufPtr)
+	}
+}
+
+// authFirstMessage 读取连接的第一条消息作为凭证
+func (s *TCPServer) authFirstMessage(conn net.Conn, reader *bufio.Reader) (*auth.Identity, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	token, err := readFrame(reader, nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.authenticator.Authenticate(string(token))
+}
+
+// readFrame 读取一条完整的消息，优先复用 buf 的内存
+func readFrame(r io.Reader, buf []byte) ([]byte, error) {
+	var header [frameHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	n := int(binary.BigEndian.Uint32(header[:]))
+	if n > maxFrameSize {
+		return nil, errFrameTooLarge
+	}
+	if cap(buf) < n {
+		buf = make([]byte, n)
+	}
+	buf = buf[:n]
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+type tcpSession struct {
+	id       string
+	uid      int64
+	identity *auth.Identity
+	conn     net.Conn
+	codec    codec.Codec
+	sendChan chan []byte
+	mu       sync.Mutex
+	closed   bool
+}
+
+func newTCPSession(conn net.Conn, c codec.Codec) *tcpSession {
+	sess := &tcpSession{
+		id:       fmt.Sprintf("%d", time.Now().UnixNano()), // Simple ID generation
+		conn:     conn,
+		codec:    c,
+		sendChan: make(chan []byte, 256), // Buffered channel
+	}
+	go sess.writePump()
+	return sess
+}
+
+// writePump 排队中的消息写入同一个 bufio.Writer，队列为空时再 Flush
+// 每次写入前设置写超时（缓冲区满时 Write 也会写到连接），对端不再读取时避免永久阻塞
+func (s *tcpSession) writePump() {
+	defer func() {
+		s.conn.Close()
+	}()
+	writer := bufio.NewWriter(s.conn)
+	var header [frameHeaderSize]byte
+	for msg := range s.sendChan {
+		s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		binary.BigEndian.PutUint32(header[:], uint32(len(msg)))
+		if _, err := writer.Write(header[:]); err != nil {
+			return
+		}
+		if _, err := writer.Write(msg); err != nil {
+			return
+		}
+		if len(s.sendChan) > 0 {
+			continue
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := writer.Flush(); err != nil {
+			return
+		}
+	}
+	// sendChan 关闭后写出缓冲区中剩余的消息
+	if writer.Buffered() > 0 {
+		s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		writer.Flush()
+	}
+}
+
+func (s *tcpSession) ID() string {
+	return s.id
+}
+
+func (s *tcpSession) Codec() codec.Codec {
+	return s.codec
+}
+
+func (s *tcpSession) Identity() *auth.Identity {
+	return s.identity
+}
+
+func (s *tcpSession) SetIdentity(id *auth.Identity) {
+	s.identity = id
+}
+
+func (s *tcpSession) UserID() int64 {
+	return s.uid
+}
+
+func (s *tcpSession) SetUserID(uid int64) {
+	s.uid = uid
+}
+
+func (s *tcpSession) Send(msg []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("session closed")
+	}
+
+	select {
+	case s.sendChan <- msg:
+		return nil
+	default:
+		return errors.New("send buffer full")
+	}
+}
+
+func (s *tcpSession) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.sendChan)
+	return s.conn.Close()
+}
@@ -0,0 +1,28 @@
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+// Stop 和 Start 并发调用时，无论 listener 是否已经创建，Start 都会退出
+func TestTCPServerStop(t *testing.T) {
+	for range 20 {
+		s := NewTCPServer("127.0.0.1:0")
+		done := make(chan error, 1)
+		go func() {
+			done <- s.Start()
+		}()
+		if err := s.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("start: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("server still listening after stop")
+		}
+	}
+}
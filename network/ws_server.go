@@ -3,6 +3,8 @@ package network
 import (
 	"errors"
 	"fmt"
+	"game_actor/auth"
+	"game_actor/codec"
 	"game_actor/session"
 	"net/http"
 	"sync"
@@ -11,25 +13,91 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
+const (
+	// 默认的 ping 间隔和读超时，读超时内没有收到任何数据（消息、pong）认为连接已断开
+	defaultPingInterval = 25 * time.Second
+	defaultReadTimeout  = 60 * time.Second
+	// 单次写入的超时，对端不再读取时避免 writePump 永久阻塞
+	writeWait = 10 * time.Second
+)
+
+// wsWriteOptions 控制 writePump 的帧类型、批量发送和 ping
+type wsWriteOptions struct {
+	// 强制使用二进制帧，否则根据 Codec 决定
+	binary bool
+	// 批量发送的最大字节数，0 表示不合并，每条消息单独一帧
+	batchSize int
+	// 批量发送时等待更多消息的最长时间，0 表示只合并已经排队的消息
+	flushLatency time.Duration
+	// 发送 ping 的间隔，0 表示不发送
+	pingInterval time.Duration
 }
 
 type WSServer struct {
-	addr     string
-	handler  func(sess session.Session, msg []byte)
-	onConnect func(sess session.Session)
-	onClose   func(sess session.Session)
+	addr      string
+	upgrader  websocket.Upgrader
+	codec     codec.Codec
+	writeOpts wsWriteOptions
+	// 读超时，每次收到数据或 pong 后顺延，0 表示不超时
+	readTimeout time.Duration
+	// 未设置时不鉴权
+	authenticator auth.Authenticator
+	authSources   auth.Source
+	handler       func(sess session.Session, msg []byte)
+	onConnect     func(sess session.Session)
+	onClose       func(sess session.Session)
 }
 
 func NewWSServer(addr string) *WSServer {
 	return &WSServer{
 		addr: addr,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool {
+				return true // Allow all origins for now
+			},
+			// 客户端可以通过 Sec-WebSocket-Protocol 选择 Codec
+			Subprotocols: codec.Names(),
+		},
+		codec: codec.JSON,
+		writeOpts: wsWriteOptions{
+			pingInterval: defaultPingInterval,
+		},
+		readTimeout: defaultReadTimeout,
 	}
 }
 
+// SetCodec 设置默认 Codec，连接握手时未指定 Codec 则使用它
+func (s *WSServer) SetCodec(c codec.Codec) {
+	s.codec = c
+}
+
+// SetBinary 所有连接都使用二进制帧发送
+func (s *WSServer) SetBinary(binary bool) {
+	s.writeOpts.binary = binary
+}
+
+// SetBatch 开启批量发送，多条消息以 [4 字节大端长度][消息] 的格式合并到一帧，客户端可用 SplitFrames 拆分
+// maxSize 为单帧的字节数上限，flushLatency 为等待更多消息的最长时间
+func (s *WSServer) SetBatch(maxSize int, flushLatency time.Duration) {
+	s.writeOpts.batchSize = maxSize
+	s.writeOpts.flushLatency = flushLatency
+}
+
+// SetHeartbeat 设置服务端 ping 间隔和读超时，0 表示关闭
+// 读超时内没有收到任何消息或 pong 的连接会被关闭，并触发 onClose
+// pingInterval 应明显小于 readTimeout；无法处理控制帧的客户端可以定时发送 heartbeat 消息
+func (s *WSServer) SetHeartbeat(pingInterval, readTimeout time.Duration) {
+	s.writeOpts.pingInterval = pingInterval
+	s.readTimeout = readTimeout
+}
+
+// SetAuthenticator 开启连接鉴权，sources 指定从 query、请求头或首条消息中读取凭证
+// 鉴权失败的连接不会触发 onConnect，也不会有消息进入 handler
+func (s *WSServer) SetAuthenticator(a auth.Authenticator, sources auth.Source) {
+	s.authenticator = a
+	s.authSources = sources
+}
+
 func (s *WSServer) SetHandler(h func(sess session.Session, msg []byte)) {
 	s.handler = h
 }
@@ -48,14 +116,58 @@ func (s *WSServer) Start() error {
 }
 
 func (s *WSServer) handleWS(w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	// 握手时通过 ?codec=proto 指定 Codec
+	c := s.codec
+	if name := r.URL.Query().Get("codec"); name != "" {
+		var ok bool
+		if c, ok = codec.Get(name); !ok {
+			http.Error(w, "unknown codec", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// 握手请求中带了凭证的，升级之前就完成鉴权
+	var identity *auth.Identity
+	if s.authenticator != nil {
+		if token := tokenFromRequest(r, s.authSources); token != "" {
+			var err error
+			if identity, err = s.authenticator.Authenticate(token); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		} else if s.authSources&auth.SourceFirstMessage == 0 {
+			http.Error(w, auth.ErrMissingToken.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		fmt.Printf("Upgrade error: %v\n", err)
 		return
 	}
+	if s.authenticator != nil && identity == nil {
+		if identity, err = s.authFirstMessage(conn); err != nil {
+			deadline := time.Now().Add(time.Second)
+			conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, err.Error()), deadline)
+			conn.Close()
+			return
+		}
+	}
+	// 子协议协商优先于 query 参数
+	if name := conn.Subprotocol(); name != "" {
+		if negotiated, ok := codec.Get(name); ok {
+			c = negotiated
+		}
+	}
+
+	opts := s.writeOpts
+	opts.binary = opts.binary || codec.IsBinary(c)
+	sess := newWSSession(conn, c, opts)
+	if identity != nil {
+		auth.Bind(sess, identity)
+	}
 
-	sess := newWSSession(conn)
-	
 	if s.onConnect != nil {
 		s.onConnect(sess)
 	}
@@ -67,30 +179,60 @@ func (s *WSServer) handleWS(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	// 收到 pong 或任何消息都顺延读超时，超时后 ReadMessage 返回错误
+	s.extendReadDeadline(conn)
+	conn.SetPongHandler(func(string) error {
+		s.extendReadDeadline(conn)
+		return nil
+	})
+
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			break
 		}
+		s.extendReadDeadline(conn)
 		if s.handler != nil {
 			s.handler(sess, message)
 		}
 	}
 }
 
+func (s *WSServer) extendReadDeadline(conn *websocket.Conn) {
+	if s.readTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(s.readTimeout))
+	}
+}
+
+// authFirstMessage 读取连接的第一条消息作为凭证
+func (s *WSServer) authFirstMessage(conn *websocket.Conn) (*auth.Identity, error) {
+	conn.SetReadDeadline(time.Now().Add(authTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+	_, token, err := conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	return s.authenticator.Authenticate(string(token))
+}
+
 type wsSession struct {
-	id     string
-	uid    int64
+	id       string
+	uid      int64
+	identity *auth.Identity
 	conn     *websocket.Conn
+	codec    codec.Codec
+	opts     wsWriteOptions
 	sendChan chan []byte
 	mu       sync.Mutex
 	closed   bool
 }
 
-func newWSSession(conn *websocket.Conn) *wsSession {
+func newWSSession(conn *websocket.Conn, c codec.Codec, opts wsWriteOptions) *wsSession {
 	sess := &wsSession{
 		id:       fmt.Sprintf("%d", time.Now().UnixNano()), // Simple ID generation
 		conn:     conn,
+		codec:    c,
+		opts:     opts,
 		sendChan: make(chan []byte, 256), // Buffered channel
 	}
 	go sess.writePump()
@@ -101,6 +243,17 @@ func (s *wsSession) writePump() {
 	defer func() {
 		s.conn.Close()
 	}()
+	msgType := websocket.TextMessage
+	if s.opts.binary {
+		msgType = websocket.BinaryMessage
+	}
+	var ping <-chan time.Time
+	if s.opts.pingInterval > 0 {
+		ticker := time.NewTicker(s.opts.pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+	var buf []byte
 	for {
 		select {
 		case msg, ok := <-s.sendChan:
@@ -109,31 +262,84 @@ func (s *wsSession) writePump() {
 				s.conn.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
+			if s.opts.batchSize <= 0 {
+				if err := s.write(msgType, msg); err != nil {
+					return
+				}
+				continue
+			}
 
-			w, err := s.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			var closed bool
+			buf, closed = s.collectBatch(appendFrame(buf[:0], msg))
+			if err := s.write(msgType, buf); err != nil {
 				return
 			}
-			w.Write(msg)
-
-			// Add queued messages to the current websocket message
-			n := len(s.sendChan)
-			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-s.sendChan)
+			if closed {
+				s.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
 			}
-
-			if err := w.Close(); err != nil {
+		case <-ping:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
 				return
 			}
 		}
 	}
 }
 
+func (s *wsSession) write(msgType int, data []byte) error {
+	s.conn.SetWriteDeadline(time.Now().Add(writeWait))
+	return s.conn.WriteMessage(msgType, data)
+}
+
+// collectBatch 合并排队中的消息，直到达到 batchSize 或等待超过 flushLatency
+// 返回的 closed 表示 sendChan 已经关闭
+func (s *wsSession) collectBatch(buf []byte) ([]byte, bool) {
+	var flush <-chan time.Time
+	if s.opts.flushLatency > 0 {
+		timer := time.NewTimer(s.opts.flushLatency)
+		defer timer.Stop()
+		flush = timer.C
+	}
+	for len(buf) < s.opts.batchSize {
+		var msg []byte
+		var ok bool
+		if flush == nil {
+			select {
+			case msg, ok = <-s.sendChan:
+			default:
+				return buf, false
+			}
+		} else {
+			select {
+			case msg, ok = <-s.sendChan:
+			case <-flush:
+				return buf, false
+			}
+		}
+		if !ok {
+			return buf, true
+		}
+		buf = appendFrame(buf, msg)
+	}
+	return buf, false
+}
+
 func (s *wsSession) ID() string {
 	return s.id
 }
 
+func (s *wsSession) Codec() codec.Codec {
+	return s.codec
+}
+
+func (s *wsSession) Identity() *auth.Identity {
+	return s.identity
+}
+
+func (s *wsSession) SetIdentity(id *auth.Identity) {
+	s.identity = id
+}
+
 func (s *wsSession) UserID() int64 {
 	return s.uid
 }
@@ -148,7 +354,7 @@ func (s *wsSession) Send(msg []byte) error {
 	if s.closed {
 		return errors.New("session closed")
 	}
-	
+
 	select {
 	case s.sendChan <- msg:
 		return nil
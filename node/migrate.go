@@ -0,0 +1,292 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game_actor/auth"
+	"game_actor/codec"
+	"game_actor/match"
+	"game_actor/service"
+	"game_actor/session"
+	"game_actor/snapshot"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// 迁移快照在 Redis 中的保留时间，目标节点取走后删除
+	migrateSnapshotTTL = time.Minute
+	// 目标节点已经取走快照后，等待恢复结果的最长时间
+	migrateClaimWait = 5 * time.Second
+	// 续连凭证的有效期，客户端需要在此之前连接新节点
+	resumeTokenTTL = 2 * time.Minute
+	// uid -> node_id，网关可以据此把用户路由到房间所在的节点
+	userNodesKey = "game:user_nodes"
+)
+
+var (
+	errNoRedis       = errors.New("migration requires redis")
+	errSameNode      = errors.New("target node is the current node")
+	errNodeNotFound  = errors.New("target node not registered")
+	errMigrateExpire = errors.New("migration snapshot expired or cancelled")
+	errMigrateLost   = fmt.Errorf("target claimed the room but did not answer, check the target node: %w", service.ErrTransferUnknown)
+)
+
+// unrouteScript 删除 game:user_nodes 中仍然指向本节点的用户，ARGV[1] 为本节点，之后为 uid
+// 用户已经被路由到其他节点（如房间迁移走）时保留
+var unrouteScript = redis.NewScript(`
+local n = 0
+for i = 2, #ARGV do
+	if redis.call("HGET", KEYS[1], ARGV[i]) == ARGV[1] then
+		n = n + redis.call("HDEL", KEYS[1], ARGV[i])
+	end
+end
+return n
+`)
+
+// migrateRequest game:migrate:{node_id} 频道的消息，快照保存在 migrateSnapshotKey 中
+type migrateRequest struct {
+	RoomID     int64  `json:"room_id"`
+	SourceNode string `json:"source_node"`
+}
+
+// migrateAck 目标节点恢复房间的结果，发布到 game:migrate_ack:{room_id}
+type migrateAck struct {
+	RoomID int64  `json:"room_id"`
+	Node   string `json:"node"`
+	Error  string `json:"error,omitempty"`
+}
+
+// migrateEvent 发给客户端的迁移通知（route 为 migrate），客户端使用 token 连接新节点并重新进入房间
+// 按连接的 Codec 编码，protobuf 格式见 envelope.proto 中的 MigrateEvent
+type migrateEvent struct {
+	Node string `json:"node"`
+	Addr string `json:"addr"`
+	// 续连凭证，只能进入该房间和该节点；未开启鉴权时为空
+	Token string `json:"token,omitempty"`
+}
+
+func (e *migrateEvent) MarshalWire() []byte {
+	var b []byte
+	for i, v := range []string{e.Node, e.Addr, e.Token} {
+		if v != "" {
+			b = protowire.AppendTag(b, protowire.Number(i+1), protowire.BytesType)
+			b = protowire.AppendString(b, v)
+		}
+	}
+	return b
+}
+
+func migrateChannel(nodeID string) string {
+	return "game:migrate:" + nodeID
+}
+
+func migrateAckChannel(roomID int64) string {
+	return fmt.Sprintf("game:migrate_ack:%d", roomID)
+}
+
+func migrateSnapshotKey(roomID int64) string {
+	return fmt.Sprintf("game:migrate:snapshot:%d", roomID)
+}
+
+// MigrateRoom 把运行中的房间迁移到 targetNode，用于下线节点前转移对局
+// 房间冻结后通过 Redis 把快照交给目标节点恢复，成功后通知客户端携带续连凭证连接新节点
+// ctx 控制冻结的最长时间，超时且目标节点还没有取走快照时房间在本节点继续运行
+func (n *GameNode) MigrateRoom(ctx context.Context, roomID int64, targetNode string) error {
+	if n.redisClient == nil {
+		return errNoRedis
+	}
+	if targetNode == n.config.NodeID {
+		return errSameNode
+	}
+	addr, err := n.redisClient.Get(ctx, fmt.Sprintf("game:nodes:%s", targetNode)).Result()
+	if err == redis.Nil {
+		return errNodeNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	transfer := func(ctx context.Context, snap *snapshot.Snapshot) error {
+		return n.transferRoom(ctx, snap, targetNode)
+	}
+	// 签发凭证失败的用户不通知，客户端断线后按正常流程重新进入
+	notify := func(uid int64, sess session.Session) []byte {
+		event := &migrateEvent{Node: targetNode, Addr: addr}
+		if n.authenticator != nil {
+			token, err := n.authenticator.Issue(&auth.Identity{
+				UID:      uid,
+				RoomID:   roomID,
+				NodeID:   targetNode,
+				ExpireAt: time.Now().Add(resumeTokenTTL),
+			})
+			if err != nil {
+				log.Printf("Issue resume token for %d error: %v", uid, err)
+				return nil
+			}
+			event.Token = token
+		}
+		c := codec.FromSession(sess)
+		payload, err := c.Marshal(event)
+		if err != nil {
+			log.Printf("Encode migrate event for %d error: %v", uid, err)
+			return nil
+		}
+		msg, err := c.Encode(&codec.Envelope{Route: "migrate", RoomID: roomID, Payload: payload})
+		if err != nil {
+			log.Printf("Encode migrate event for %d error: %v", uid, err)
+			return nil
+		}
+		return msg
+	}
+	if err := n.roomSvc.MigrateRoom(ctx, roomID, transfer, notify); err != nil {
+		return err
+	}
+	log.Printf("Room %d migrated to %s (%s)", roomID, targetNode, addr)
+	return nil
+}
+
+// DrainTo 把本节点的所有房间迁移到 targetNode，单个房间失败不影响其他房间
+func (n *GameNode) DrainTo(ctx context.Context, targetNode string) error {
+	var roomIDs []int64
+	n.roomSvc.Rooms.Range(func(key, value any) bool {
+		roomIDs = append(roomIDs, key.(int64))
+		return true
+	})
+	var errs []error
+	for _, roomID := range roomIDs {
+		if err := n.MigrateRoom(ctx, roomID, targetNode); err != nil {
+			errs = append(errs, fmt.Errorf("migrate room %d: %w", roomID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// transferRoom 保存快照并通知目标节点，等待恢复结果
+func (n *GameNode) transferRoom(ctx context.Context, snap *snapshot.Snapshot, targetNode string) error {
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	// 先订阅结果再发请求，避免错过目标节点的回复
+	pubsub := n.redisClient.Subscribe(ctx, migrateAckChannel(snap.RoomID))
+	defer pubsub.Close()
+	if _, err := pubsub.Receive(ctx); err != nil {
+		return err
+	}
+	key := migrateSnapshotKey(snap.RoomID)
+	if err := n.redisClient.Set(ctx, key, body, migrateSnapshotTTL).Err(); err != nil {
+		return err
+	}
+	req, _ := json.Marshal(&migrateRequest{RoomID: snap.RoomID, SourceNode: n.config.NodeID})
+	if err := n.redisClient.Publish(ctx, migrateChannel(targetNode), req).Err(); err != nil {
+		n.redisClient.Del(context.Background(), key)
+		return err
+	}
+
+	ch := pubsub.Channel()
+	select {
+	case msg := <-ch:
+		return parseAck(msg)
+	case <-ctx.Done():
+	}
+	// 目标节点还没有取走快照时可以安全地放弃迁移
+	if deleted, err := n.redisClient.Del(context.Background(), key).Result(); err == nil && deleted == 1 {
+		return ctx.Err()
+	}
+	// 已经取走，等待恢复结果；仍然没有回复时房间不能在本节点解冻，见 service.ErrTransferUnknown
+	select {
+	case msg := <-ch:
+		return parseAck(msg)
+	case <-time.After(migrateClaimWait):
+		return errMigrateLost
+	}
+}
+
+func parseAck(msg *redis.Message) error {
+	var ack migrateAck
+	if err := json.Unmarshal([]byte(msg.Payload), &ack); err != nil {
+		return err
+	}
+	if ack.Error != "" {
+		return errors.New(ack.Error)
+	}
+	return nil
+}
+
+// unrouteUsers 房间关闭或迁移走之后，删除 game:user_nodes 中仍然指向本节点的房间玩家
+func unrouteUsers(client *redis.Client, nodeID string, matchInfo *match.MatchInfo) {
+	if matchInfo == nil || len(matchInfo.Players) == 0 {
+		return
+	}
+	args := make([]any, 0, len(matchInfo.Players)+1)
+	args = append(args, nodeID)
+	for _, player := range matchInfo.Players {
+		args = append(args, strconv.FormatInt(player.PlayerUID, 10))
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := unrouteScript.Run(ctx, client, []string{userNodesKey}, args...).Err(); err != nil {
+		log.Printf("Failed to clean user routes: %v", err)
+	}
+}
+
+// subscribeMigrateChannel 接收其他节点迁移过来的房间
+func (n *GameNode) subscribeMigrateChannel() {
+	ctx := context.Background()
+	pubsub := n.redisClient.Subscribe(ctx, migrateChannel(n.config.NodeID))
+	defer pubsub.Close()
+
+	for msg := range pubsub.Channel() {
+		var req migrateRequest
+		if err := json.Unmarshal([]byte(msg.Payload), &req); err != nil {
+			log.Printf("Invalid migrate message: %v", err)
+			continue
+		}
+		ack := &migrateAck{RoomID: req.RoomID, Node: n.config.NodeID}
+		if err := n.receiveRoom(ctx, req.RoomID); err != nil {
+			log.Printf("Receive room %d from %s error: %v", req.RoomID, req.SourceNode, err)
+			ack.Error = err.Error()
+		} else {
+			log.Printf("Received room %d from %s", req.RoomID, req.SourceNode)
+		}
+		body, _ := json.Marshal(ack)
+		if err := n.redisClient.Publish(ctx, migrateAckChannel(req.RoomID), body).Err(); err != nil {
+			log.Printf("Failed to publish migrate ack: %v", err)
+		}
+	}
+}
+
+// receiveRoom 取走快照（源节点超时放弃后取不到），恢复房间并把玩家路由到本节点
+func (n *GameNode) receiveRoom(ctx context.Context, roomID int64) error {
+	body, err := n.redisClient.GetDel(ctx, migrateSnapshotKey(roomID)).Bytes()
+	if err == redis.Nil {
+		return errMigrateExpire
+	}
+	if err != nil {
+		return err
+	}
+	snap := new(snapshot.Snapshot)
+	if err := json.Unmarshal(body, snap); err != nil {
+		return err
+	}
+	if err := n.roomSvc.RestoreRoom(snap); err != nil {
+		return err
+	}
+	if len(snap.Players) > 0 {
+		routes := make(map[string]any, len(snap.Players))
+		for _, uid := range snap.Players {
+			routes[strconv.FormatInt(uid, 10)] = n.config.NodeID
+		}
+		if err := n.redisClient.HSet(ctx, userNodesKey, routes).Err(); err != nil {
+			log.Printf("Failed to update user routes for room %d: %v", roomID, err)
+		}
+	}
+	return nil
+}
@@ -3,9 +3,14 @@ package node
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"game_actor/auth"
 	"game_actor/discovery"
+	"game_actor/match"
 	"game_actor/network"
+	"game_actor/room"
+	"game_actor/router"
 	"game_actor/service"
 	"game_actor/session"
 	"log"
@@ -21,18 +26,39 @@ type GameNodeConfig struct {
 	NodeID        string
 	Host          string
 	Port          int
+	TCPPort       int // 0 表示不开启 TCP 服务
+	KCPPort       int // 0 表示不开启 KCP（可靠 UDP）服务
 	EtcdEndpoints []string
 	RedisAddr     string // e.g. "localhost:6379"
 	ServiceName   string
 	TTL           int64
+	// 票据签名密钥，为空时不鉴权，信任客户端上报的 uid（仅用于开发调试）
+	TicketSecret string
+}
+
+// errRoomNotAllowed 票据不允许进入请求的房间
+var (
+	errRoomNotAllowed = errors.New("ticket not valid for this room")
+	errNotInRoom      = errors.New("not in this room")
+)
+
+// kickMsg game:kick 频道的消息
+type kickMsg struct {
+	UID        int64  `json:"uid"`
+	SourceNode string `json:"source_node"`
 }
 
 type GameNode struct {
 	config      *GameNodeConfig
 	roomSvc     *service.RoomService
 	wsServer    *network.WSServer
+	tcpServer   *network.TCPServer
+	kcpServer   *network.KCPServer
+	router      *router.Router
 	discovery   discovery.Discovery
 	redisClient *redis.Client
+	// 开启鉴权时不为空，迁移房间时用于签发续连凭证
+	authenticator *auth.TicketAuthenticator
 }
 
 func NewGameNode(config *GameNodeConfig, roomBuilder service.Builder) (*GameNode, error) {
@@ -48,7 +74,7 @@ func NewGameNode(config *GameNodeConfig, roomBuilder service.Builder) (*GameNode
 		// Define publisher function
 		kickPublisher = func(uid int64) {
 			ctx := context.Background()
-			msg := fmt.Sprintf(`{"uid": %d, "source_node": "%s"}`, uid, config.NodeID)
+			msg, _ := json.Marshal(&kickMsg{UID: uid, SourceNode: config.NodeID})
 			if err := redisClient.Publish(ctx, "game:kick", msg).Err(); err != nil {
 				log.Printf("Failed to publish kick message: %v", err)
 			}
@@ -56,12 +82,31 @@ func NewGameNode(config *GameNodeConfig, roomBuilder service.Builder) (*GameNode
 	}
 
 	// Initialize RoomService
-	roomSvc := service.NewRoomService(roomBuilder, kickPublisher)
+	var svcOpts []service.OptionFunc
+	if redisClient != nil {
+		// 房间关闭或迁移走之后清理 game:user_nodes 中的路由
+		svcOpts = append(svcOpts, service.WithRemoveHook(func(roomID int64, matchInfo *match.MatchInfo) {
+			go unrouteUsers(redisClient, config.NodeID, matchInfo)
+		}))
+	}
+	roomSvc := service.NewRoomService(roomBuilder, kickPublisher, svcOpts...)
 
 	// Initialize WS Server
 	addr := fmt.Sprintf("%s:%d", config.Host, config.Port)
 	wsServer := network.NewWSServer(addr)
 
+	// Initialize TCP Server if configured
+	var tcpServer *network.TCPServer
+	if config.TCPPort > 0 {
+		tcpServer = network.NewTCPServer(fmt.Sprintf("%s:%d", config.Host, config.TCPPort))
+	}
+
+	// Initialize KCP Server if configured
+	var kcpServer *network.KCPServer
+	if config.KCPPort > 0 {
+		kcpServer = network.NewKCPServer(fmt.Sprintf("%s:%d", config.Host, config.KCPPort), network.DefaultKCPConfig())
+	}
+
 	// Initialize Etcd Discovery
 	var d discovery.Discovery
 	if len(config.EtcdEndpoints) > 0 {
@@ -76,15 +121,45 @@ func NewGameNode(config *GameNodeConfig, roomBuilder service.Builder) (*GameNode
 		config:      config,
 		roomSvc:     roomSvc,
 		wsServer:    wsServer,
+		tcpServer:   tcpServer,
+		kcpServer:   kcpServer,
+		router:      router.New(roomSvc.GetRoom),
 		redisClient: redisClient,
 		discovery:   d,
 	}
+	// Setup authentication
+	if config.TicketSecret != "" {
+		authenticator := auth.NewTicketAuthenticator([]byte(config.TicketSecret), config.NodeID)
+		node.authenticator = authenticator
+		wsServer.SetAuthenticator(authenticator, auth.SourceAll)
+		if tcpServer != nil {
+			tcpServer.SetAuthenticator(authenticator)
+		}
+		if kcpServer != nil {
+			kcpServer.SetAuthenticator(authenticator)
+		}
+	} else {
+		log.Printf("WARNING: TicketSecret is empty, client connections are not authenticated")
+	}
+	node.registerRoutes()
 
 	// Setup WS handlers
 	wsServer.SetHandler(node.handleWSMessage)
 	wsServer.SetOnConnect(node.handleWSConnect)
 	wsServer.SetOnClose(node.handleWSClose)
 
+	// TCP/KCP 连接和 WS 连接共用同一套 handler
+	if tcpServer != nil {
+		tcpServer.SetHandler(node.handleWSMessage)
+		tcpServer.SetOnConnect(node.handleWSConnect)
+		tcpServer.SetOnClose(node.handleWSClose)
+	}
+	if kcpServer != nil {
+		kcpServer.SetHandler(node.handleWSMessage)
+		kcpServer.SetOnConnect(node.handleWSConnect)
+		kcpServer.SetOnClose(node.handleWSClose)
+	}
+
 	return node, nil
 }
 
@@ -92,6 +167,8 @@ func (n *GameNode) Start() error {
 	// 1. Start Redis Subscriber
 	if n.redisClient != nil {
 		go n.subscribeKickChannel()
+		// 接收其他节点迁移过来的房间
+		go n.subscribeMigrateChannel()
 		// Also register to Redis for OpenResty discovery
 		go n.registerToRedis()
 	}
@@ -104,7 +181,27 @@ func (n *GameNode) Start() error {
 		}
 	}()
 
-	// 3. Register to Etcd
+	// 3. Start TCP Server in a goroutine
+	if n.tcpServer != nil {
+		go func() {
+			log.Printf("Starting TCP server on %s:%d", n.config.Host, n.config.TCPPort)
+			if err := n.tcpServer.Start(); err != nil {
+				log.Fatalf("TCP server failed: %v", err)
+			}
+		}()
+	}
+
+	// 4. Start KCP Server in a goroutine
+	if n.kcpServer != nil {
+		go func() {
+			log.Printf("Starting KCP server on %s:%d", n.config.Host, n.config.KCPPort)
+			if err := n.kcpServer.Start(); err != nil {
+				log.Fatalf("KCP server failed: %v", err)
+			}
+		}()
+	}
+
+	// 5. Register to Etcd
 	if n.discovery != nil {
 		// Address for Nginx to proxy to (e.g., 127.0.0.1:8080)
 		addr := fmt.Sprintf("%s:%d", n.config.Host, n.config.Port)
@@ -153,11 +250,7 @@ func (n *GameNode) subscribeKickChannel() {
 	ch := pubsub.Channel()
 	for msg := range ch {
 		// Parse message
-		type KickMsg struct {
-			UID        int64  `json:"uid"`
-			SourceNode string `json:"source_node"`
-		}
-		var kick KickMsg
+		var kick kickMsg
 		if err := json.Unmarshal([]byte(msg.Payload), &kick); err != nil {
 			log.Printf("Invalid kick message: %v", err)
 			continue
@@ -174,6 +267,12 @@ func (n *GameNode) subscribeKickChannel() {
 }
 
 func (n *GameNode) Stop() {
+	if n.tcpServer != nil {
+		n.tcpServer.Stop()
+	}
+	if n.kcpServer != nil {
+		n.kcpServer.Stop()
+	}
 	if n.discovery != nil {
 		n.discovery.Close()
 	}
@@ -193,6 +292,11 @@ func (n *GameNode) GetRoomService() *service.RoomService {
 	return n.roomSvc
 }
 
+// GetRouter 游戏逻辑通过 Router 注册自己的消息 handler
+func (n *GameNode) GetRouter() *router.Router {
+	return n.router
+}
+
 // WebSocket Handlers
 
 func (n *GameNode) handleWSConnect(sess session.Session) {
@@ -201,55 +305,66 @@ func (n *GameNode) handleWSConnect(sess session.Session) {
 
 func (n *GameNode) handleWSClose(sess session.Session) {
 	log.Printf("Session closed: %s (UID: %d)", sess.ID(), sess.UserID())
-	// Handle user disconnection logic here if needed
-	// Note: RoomService.UserLeaveRoom is usually called by game logic,
-	// but we might want to clean up if the connection drops unexpectedly.
+	if sess.UserID() == 0 {
+		return
+	}
+	// 房间根据重连保留期决定保留座位还是直接离开
+	if err := n.roomSvc.UserDisconnect(sess.UserID(), sess); err != nil {
+		log.Printf("UserDisconnect error: %v", err)
+	}
 }
 
 func (n *GameNode) handleWSMessage(sess session.Session, msg []byte) {
-	// Simple JSON protocol
-	type Request struct {
-		RoomID int64           `json:"room_id"`
-		UID    int64           `json:"uid"`
-		Action string          `json:"action"` // "enter", "leave", "message"
-		Data   json.RawMessage `json:"data"`
-	}
-
-	var req Request
-	if err := json.Unmarshal(msg, &req); err != nil {
-		log.Printf("Invalid message format from %s: %v", sess.ID(), err)
-		return
-	}
+	n.router.Dispatch(sess, msg)
+}
 
-	// Bind session to user if UID is provided (Simplified auth)
-	if req.UID > 0 {
-		sess.SetUserID(req.UID)
+// registerRoutes 注册内置的 enter/leave/spectate/pause_vote/message 路由
+func (n *GameNode) registerRoutes() {
+	if n.config.TicketSecret == "" {
+		// 未开启鉴权时使用客户端上报的 uid (Simplified auth)
+		n.router.Use(func(next router.HandlerFunc) router.HandlerFunc {
+			return func(ctx *router.Context) (any, error) {
+				if ctx.Request.UID > 0 {
+					ctx.Session.SetUserID(ctx.Request.UID)
+				}
+				return next(ctx)
+			}
+		})
 	}
+	n.router.Use(router.Logging())
 
-	log.Printf("Action: %s, Room: %d, UID: %d", req.Action, req.RoomID, req.UID)
-
-	switch req.Action {
-	case "enter":
-		if err := n.roomSvc.UserEnterRoom(req.UID, req.RoomID, sess); err != nil {
-			log.Printf("UserEnterRoom error: %v", err)
-			sess.Send([]byte(fmt.Sprintf(`{"error": "%s"}`, err.Error())))
-		} else {
-			sess.Send([]byte(`{"status": "ok", "action": "enter"}`))
+	n.router.Handle("enter", func(ctx *router.Context) (any, error) {
+		// 票据绑定了房间时只能进入该房间
+		if id, ok := auth.IdentityOf(ctx.Session); ok && id.RoomID != 0 && id.RoomID != ctx.Request.RoomID {
+			return nil, errRoomNotAllowed
 		}
-	case "leave":
-		if err := n.roomSvc.UserLeaveRoom(req.UID, req.RoomID); err != nil {
-			log.Printf("UserLeaveRoom error: %v", err)
-		} else {
-			sess.Send([]byte(`{"status": "ok", "action": "leave"}`))
+		return nil, n.roomSvc.UserEnterRoom(ctx.UID(), ctx.Request.RoomID, ctx.Session)
+	}, router.Auth())
+	n.router.Handle("leave", func(ctx *router.Context) (any, error) {
+		return nil, n.roomSvc.UserLeaveRoom(ctx.UID(), ctx.Request.RoomID)
+	}, router.Auth())
+	n.router.Handle("spectate", func(ctx *router.Context) (any, error) {
+		if id, ok := auth.IdentityOf(ctx.Session); ok && id.RoomID != 0 && id.RoomID != ctx.Request.RoomID {
+			return nil, errRoomNotAllowed
 		}
-	case "message":
-		// Broadcast to room (default channel)
-		if room, ok := n.roomSvc.GetRoom(req.RoomID); ok {
-			room.Broadcast(fmt.Sprintf("%d", req.RoomID), req.Data)
-		} else {
-			sess.Send([]byte(`{"error": "room not found"}`))
+		return nil, n.roomSvc.SpectateRoom(ctx.UID(), ctx.Request.RoomID, ctx.Session)
+	}, router.Auth())
+	n.router.Handle("pause_vote", func(ctx *router.Context) (any, error) {
+		return nil, n.roomSvc.VotePause(ctx.UID(), ctx.Request.RoomID)
+	}, router.Auth())
+	// Broadcast to room (default channel)
+	n.router.HandleRoom("message", func(ctx *router.Context) (any, error) {
+		r, ok := ctx.Room.(interface{ Base() *room.BaseRoom })
+		if !ok {
+			return nil, errors.New("room does not support message")
 		}
-	default:
-		sess.Send([]byte(`{"error": "unknown action"}`))
-	}
+		// 已经在房间 actor 中，直接广播，只有房间内的用户可以发言
+		base := r.Base()
+		if !base.InRoom(ctx.UID()) {
+			return nil, errNotInRoom
+		}
+		// 每个接收者按自己连接的 Codec 收到信封，Payload 原样转发
+		base.BroadcastPayload(room.RoomChannel(ctx.Request.RoomID), ctx.UID(), "message", ctx.Request.Payload)
+		return nil, nil
+	}, router.Auth())
 }
@@ -0,0 +1,245 @@
+package replay
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"game_actor/clock"
+	"game_actor/codec"
+	"game_actor/match"
+	"game_actor/room"
+	"game_actor/router"
+	"game_actor/session"
+	"time"
+)
+
+var ErrNoCreate = errors.New("replay: recording does not start with room creation")
+
+// BuildFunc 创建回放用的房间，需要和录制时使用相同的游戏逻辑和配置
+// opts 中包含虚拟时钟和录制，需要传给 room.NewRoomActor
+type BuildFunc func(roomID int64, matchInfo *match.MatchInfo, opts ...room.OptionFunc) *room.RoomActor
+
+// InboundFunc 回放一条客户端消息，sess 为该用户当前的回放 session
+// 在回放 goroutine 中调用，需要自己把处理逻辑投递到房间 actor 中
+type InboundFunc func(r *room.RoomActor, sess session.Session, e *room.RecordEvent)
+
+// RouterInbound 通过 router 回放客户端消息，和线上一样经过中间件和房间级 handler
+// register 中注册和线上相同的路由，router 的房间查找固定返回回放的房间
+func RouterInbound(register func(rt *router.Router)) InboundFunc {
+	var (
+		rt      *router.Router
+		current *room.RoomActor
+	)
+	return func(r *room.RoomActor, sess session.Session, e *room.RecordEvent) {
+		current = r
+		if rt == nil {
+			rt = router.New(func(roomID int64) (room.GameRoom, bool) {
+				return current, current != nil
+			})
+			register(rt)
+		}
+		c := codec.FromSession(sess)
+		msg, err := c.Encode(&codec.Envelope{
+			MsgID:   e.Code,
+			Route:   e.Name,
+			RoomID:  r.GetRoomID(),
+			UID:     e.UID,
+			Payload: e.Data,
+		})
+		if err != nil {
+			return
+		}
+		rt.Dispatch(sess, msg)
+	}
+}
+
+// Replay 使用虚拟时钟把录制的输入按原来的时间重新喂给新的房间，返回新房间的录制
+// 每个输入之前先触发所有到期的定时器和逻辑帧，游戏逻辑是确定性的时两次录制的输出相同，见 Diff
+// 房间停止等导致回放无法继续时返回已经回放的部分和错误；回放的命令返回的错误（如在不允许的状态下暂停）不中断回放，
+// 全部合并后返回，录制时同样失败的命令回放时也会失败
+func Replay(rec *Recording, build BuildFunc, inbound InboundFunc) (*Recording, error) {
+	if len(rec.Events) == 0 || rec.Events[0].Kind != room.RecordCreate {
+		return nil, ErrNoCreate
+	}
+	fc := clock.NewFake(rec.Start())
+	out := NewMemoryRecorder(rec.RoomID, rec.MatchInfo)
+	r := build(rec.RoomID, rec.MatchInfo, room.WithClock(fc), room.WithRecorder(out))
+	d := &driver{
+		room:     r,
+		clock:    fc,
+		inbound:  inbound,
+		sessions: make(map[int64]*replaySession),
+	}
+	defer r.Actor().Stop()
+
+	var errs []error
+	for i, e := range rec.Events {
+		if i == 0 || e.Kind.IsOutput() {
+			continue
+		}
+		if err := d.advance(e.At); err != nil {
+			if d.closed() {
+				break
+			}
+			return out.Recording(), fmt.Errorf("replay: advance to event %d: %w", i, err)
+		}
+		if err := d.apply(e); err != nil {
+			errs = append(errs, fmt.Errorf("replay: event %d %s: %w", i, e.Name, err))
+		}
+		// mailbox 按顺序执行，等待上面投递的任务完成
+		if err := r.Actor().RunPending(); err != nil {
+			if d.closed() {
+				break
+			}
+			return out.Recording(), fmt.Errorf("replay: event %d %s: %w", i, e.Name, err)
+		}
+	}
+	// 最后一个输入之后的定时器，如延迟发送给观战者的消息
+	if !d.closed() {
+		if err := d.advance(rec.Events[len(rec.Events)-1].At); err != nil && !d.closed() {
+			errs = append(errs, fmt.Errorf("replay: advance to end: %w", err))
+		}
+	}
+	return out.Recording(), errors.Join(errs...)
+}
+
+// Advance 把虚拟时钟推进到 to，逐个触发期间到期的定时器和逻辑帧，每个都在准确的时间执行完再触发下一个
+// 录制用于回放对比的原始房间时也应使用 Advance 推进时间，保证两次运行的定时器顺序相同
+func Advance(c *clock.Fake, r *room.RoomActor, to time.Time) error {
+	for c.Step(to) {
+		if err := r.Actor().RunPending(); err != nil {
+			return err
+		}
+	}
+	c.Set(to)
+	return r.Actor().RunPending()
+}
+
+// Diff 比较两次录制的输出，返回第一处不同
+func Diff(want, got *Recording) error {
+	w, g := want.Outputs(), got.Outputs()
+	for i := 0; i < len(w) && i < len(g); i++ {
+		a, b := w[i], g[i]
+		if !a.At.Equal(b.At) || a.Kind != b.Kind || a.UID != b.UID || a.Name != b.Name || a.Code != b.Code || !bytes.Equal(a.Data, b.Data) {
+			return fmt.Errorf("replay: output %d differs: want %s, got %s", i, describe(want, a), describe(got, b))
+		}
+	}
+	if len(w) != len(g) {
+		return fmt.Errorf("replay: output count differs: want %d, got %d", len(w), len(g))
+	}
+	return nil
+}
+
+func describe(rec *Recording, e *room.RecordEvent) string {
+	return fmt.Sprintf("{at:+%v kind:%d uid:%d name:%q code:%d data:%q}", e.At.Sub(rec.Start()), e.Kind, e.UID, e.Name, e.Code, e.Data)
+}
+
+type driver struct {
+	room     *room.RoomActor
+	clock    *clock.Fake
+	inbound  InboundFunc
+	sessions map[int64]*replaySession
+}
+
+func (d *driver) advance(to time.Time) error {
+	return Advance(d.clock, d.room, to)
+}
+
+// closed 房间关闭后 actor 停止，录制中之后不会再有输入
+func (d *driver) closed() bool {
+	return d.room.GetStatus() == room.RoomStatus_Close
+}
+
+// apply 回放一个输入，返回命令的错误，客户端消息的错误由 handler 回包给客户端，不在这里返回
+func (d *driver) apply(e *room.RecordEvent) error {
+	r := d.room
+	roomID := r.GetRoomID()
+	switch e.Kind {
+	case room.RecordInbound:
+		if d.inbound != nil {
+			d.inbound(r, d.session(e.UID), e)
+		}
+		return nil
+	case room.RecordCommand:
+	default:
+		return nil
+	}
+
+	switch e.Name {
+	case room.CommandEnter:
+		var sess session.Session
+		if e.Code == 1 {
+			sess = d.newSession(e.UID)
+		}
+		r.UserEnterRoom(e.UID, roomID, sess)
+	case room.CommandLeave:
+		r.UserLeaveRoom(e.UID, roomID)
+	case room.CommandDisconnect:
+		r.UserDisconnect(e.UID, d.session(e.UID))
+	case room.CommandKick:
+		r.KickUser(e.UID)
+	case room.CommandSpectate:
+		return r.SpectatorEnter(e.UID, d.newSession(e.UID))
+	case room.CommandSpectatorLeave:
+		r.SpectatorLeave(e.UID)
+	case room.CommandJoinChannel:
+		r.JoinChannel(room.ChannelID(e.Data), e.UID, d.session(e.UID))
+	case room.CommandLeaveChannel:
+		r.LeaveChannel(room.ChannelID(e.Data), e.UID)
+	case room.CommandStart:
+		return r.Start()
+	case room.CommandTransition:
+		return r.Transition(int32(e.Code))
+	case room.CommandPause:
+		return r.Pause()
+	case room.CommandResume:
+		return r.Resume()
+	case room.CommandVotePause:
+		_, err := r.VotePause(e.UID)
+		return err
+	case room.CommandClose:
+		r.Close(room.CloseReason(e.Code))
+	default:
+		return fmt.Errorf("unknown command %q", e.Name)
+	}
+	return nil
+}
+
+// newSession 用户每次带 session 进入房间时都是新的连接
+func (d *driver) newSession(uid int64) session.Session {
+	sess := &replaySession{uid: uid}
+	d.sessions[uid] = sess
+	return sess
+}
+
+func (d *driver) session(uid int64) session.Session {
+	if sess, ok := d.sessions[uid]; ok {
+		return sess
+	}
+	return d.newSession(uid)
+}
+
+// replaySession 回放用的 session，发送的消息已经由房间录制，这里直接丢弃
+type replaySession struct {
+	uid int64
+}
+
+func (s *replaySession) ID() string {
+	return fmt.Sprintf("replay-%d", s.uid)
+}
+
+func (s *replaySession) UserID() int64 {
+	return s.uid
+}
+
+func (s *replaySession) SetUserID(uid int64) {
+	s.uid = uid
+}
+
+func (s *replaySession) Send(msg []byte) error {
+	return nil
+}
+
+func (s *replaySession) Close() error {
+	return nil
+}
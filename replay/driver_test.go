@@ -0,0 +1,196 @@
+package replay_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"game_actor/clock"
+	"game_actor/codec"
+	"game_actor/match"
+	"game_actor/replay"
+	"game_actor/room"
+	"game_actor/router"
+	"strings"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// echoGame 确定性的游戏逻辑：每帧把收到的 say 合并广播，delay 在 150ms 后单独回给发送者
+type echoGame struct {
+	r    *room.RoomActor
+	said []string
+}
+
+func (g *echoGame) OnTick(dt time.Duration, frame uint64) {
+	if len(g.said) == 0 {
+		return
+	}
+	g.r.BaseRoom.Broadcast(room.RoomChannel(g.r.RoomID), fmt.Appendf(nil, "%d:%s", frame, strings.Join(g.said, ",")))
+	g.said = nil
+}
+
+// games 回放时从 handler 中找到房间对应的游戏逻辑
+type games map[int64]*echoGame
+
+func (gs games) build(roomID int64, matchInfo *match.MatchInfo, opts ...room.OptionFunc) *room.RoomActor {
+	g := &echoGame{}
+	opts = append(opts, room.WithTickRate(10), room.WithTickOption(g))
+	g.r = room.NewRoomActor(roomID, matchInfo, opts...)
+	gs[roomID] = g
+	return g.r
+}
+
+func (gs games) register(rt *router.Router) {
+	rt.HandleRoom("say", func(ctx *router.Context) (any, error) {
+		g := gs[ctx.Request.RoomID]
+		g.said = append(g.said, fmt.Sprintf("%d=%s", ctx.UID(), ctx.Request.Payload))
+		return nil, nil
+	})
+	rt.HandleRoom("delay", func(ctx *router.Context) (any, error) {
+		g, uid := gs[ctx.Request.RoomID], ctx.UID()
+		g.r.AfterFunc(150*time.Millisecond, func() {
+			g.r.BaseRoom.SendTo(uid, []byte("delayed"))
+		})
+		return nil, nil
+	})
+}
+
+type testSession struct {
+	uid int64
+}
+
+func (s *testSession) ID() string          { return fmt.Sprintf("test-%d", s.uid) }
+func (s *testSession) UserID() int64       { return s.uid }
+func (s *testSession) SetUserID(uid int64) { s.uid = uid }
+func (s *testSession) Send(msg []byte) error {
+	return nil
+}
+func (s *testSession) Close() error { return nil }
+
+// recordMatch 在虚拟时间中运行一局并录制
+func recordMatch(t *testing.T) *replay.Recording {
+	t.Helper()
+	matchInfo := &match.MatchInfo{Players: []*match.Player{{PlayerUID: 1}, {PlayerUID: 2}}}
+	fc := clock.NewFake(epoch)
+	rec := replay.NewMemoryRecorder(7, matchInfo)
+	gs := games{}
+	r := gs.build(7, matchInfo, room.WithClock(fc), room.WithRecorder(rec))
+	rt := router.New(func(roomID int64) (room.GameRoom, bool) {
+		return r, roomID == 7
+	})
+	gs.register(rt)
+
+	sessions := map[int64]*testSession{1: {uid: 1}, 2: {uid: 2}}
+	// 和回放一样，每个输入执行完再推进时间
+	run := func(f func()) {
+		t.Helper()
+		f()
+		if err := r.Actor().RunPending(); err != nil {
+			t.Fatalf("run pending: %v", err)
+		}
+	}
+	advance := func(d time.Duration) {
+		t.Helper()
+		if err := replay.Advance(fc, r, fc.Now().Add(d)); err != nil {
+			t.Fatalf("advance: %v", err)
+		}
+	}
+	send := func(uid int64, route, payload string) {
+		t.Helper()
+		msg, err := codec.FromSession(sessions[uid]).Encode(&codec.Envelope{Route: route, RoomID: 7, Payload: []byte(payload)})
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		run(func() { rt.Dispatch(sessions[uid], msg) })
+	}
+
+	run(func() { r.UserEnterRoom(1, 7, sessions[1]) })
+	advance(30 * time.Millisecond)
+	run(func() { r.UserEnterRoom(2, 7, sessions[2]) })
+	advance(120 * time.Millisecond)
+	send(1, "say", `"hi"`)
+	send(2, "say", `"yo"`)
+	advance(50 * time.Millisecond)
+	send(2, "delay", "")
+	advance(110 * time.Millisecond)
+	send(1, "say", `"bye"`)
+	advance(300 * time.Millisecond)
+	// Close 等待关闭逻辑执行完并停止 actor
+	r.Close(room.CloseNormal)
+	return rec.Recording()
+}
+
+// 录制 -> 回放 -> Diff，确定性的游戏逻辑两次的输出完全相同
+func TestReplayDeterministic(t *testing.T) {
+	rec := recordMatch(t)
+	var broadcasts, sends int
+	for _, e := range rec.Outputs() {
+		if e.Kind == room.RecordOutbound && e.UID == 0 && bytes.Contains(e.Data, []byte("=")) {
+			broadcasts++
+		}
+		if e.Kind == room.RecordOutbound && e.UID == 2 && string(e.Data) == "delayed" {
+			sends++
+		}
+	}
+	if broadcasts != 2 || sends != 1 {
+		t.Fatalf("recorded %d broadcasts and %d delayed sends, want 2 and 1", broadcasts, sends)
+	}
+
+	gs := games{}
+	out, err := replay.Replay(rec, gs.build, replay.RouterInbound(gs.register))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := replay.Diff(rec, out); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 游戏逻辑不确定时 Diff 报告第一处不同
+func TestReplayDiff(t *testing.T) {
+	rec := recordMatch(t)
+	gs := games{}
+	register := func(rt *router.Router) {
+		gs.register(rt)
+		rt.HandleRoom("say", func(ctx *router.Context) (any, error) {
+			g := gs[ctx.Request.RoomID]
+			g.said = append(g.said, "changed")
+			return nil, nil
+		})
+	}
+	out, err := replay.Replay(rec, gs.build, replay.RouterInbound(register))
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if err := replay.Diff(rec, out); err == nil || !strings.Contains(err.Error(), "differs") {
+		t.Fatalf("diff: got %v, want a difference", err)
+	}
+}
+
+// 回放的命令失败时返回错误，回放继续执行后面的输入
+func TestReplayCommandError(t *testing.T) {
+	matchInfo := &match.MatchInfo{Players: []*match.Player{{PlayerUID: 1}}}
+	rec := &replay.Recording{
+		Header: replay.Header{RoomID: 7, MatchInfo: matchInfo},
+		Events: []*room.RecordEvent{
+			{At: epoch, Kind: room.RecordCreate},
+			// 房间还没有开始，不能暂停
+			{At: epoch.Add(time.Second), Kind: room.RecordCommand, Name: room.CommandPause},
+			{At: epoch.Add(2 * time.Second), Kind: room.RecordCommand, UID: 1, Name: room.CommandEnter},
+		},
+	}
+	gs := games{}
+	out, err := replay.Replay(rec, gs.build, nil)
+	if !errors.Is(err, room.ErrRoomNotRunning) {
+		t.Fatalf("replay: got %v, want ErrRoomNotRunning", err)
+	}
+	// 玩家全部进入后房间开始
+	if status := gs[7].r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room status %d after replay, want started", status)
+	}
+	if out == nil || len(out.Outputs()) == 0 {
+		t.Fatal("replay returned no recording")
+	}
+}
@@ -0,0 +1,234 @@
+// Package replay 房间录制文件的读写和回放
+//
+// 文件只追加写入，格式为：
+//
+//	header: "GARP" | version(1 字节) | varint RoomID | uvarint 长度 + MatchInfo(JSON)
+//	record: varint 时间(第一条为 unix 纳秒，之后为距离上一条的纳秒数) | kind(1 字节)
+//	        | varint UID | uvarint 长度 + Name | uvarint Code | uvarint 长度 + Data
+//
+// 进程崩溃时文件末尾可能有不完整的记录，ReadFile 返回已经读到的部分和 ErrTruncated
+package replay
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game_actor/match"
+	"game_actor/room"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	magic   = "GARP"
+	version = 1
+	// 单个字段的最大长度，防止读到损坏的文件时分配过大的内存
+	maxFieldSize = 64 << 20
+)
+
+var (
+	ErrBadMagic   = errors.New("replay: not a recording file")
+	ErrBadVersion = errors.New("replay: unsupported version")
+	ErrTruncated  = errors.New("replay: truncated recording")
+)
+
+// Header 录制文件头，回放时用于创建相同的房间
+type Header struct {
+	RoomID    int64
+	MatchInfo *match.MatchInfo
+}
+
+// Recording 完整的录制，第一条事件为 room.RecordCreate
+type Recording struct {
+	Header
+	Events []*room.RecordEvent
+}
+
+// Start 录制开始的时间，即房间创建的时间
+func (r *Recording) Start() time.Time {
+	if len(r.Events) == 0 {
+		return time.Time{}
+	}
+	return r.Events[0].At
+}
+
+// Outputs 房间的输出（发出的消息和状态切换），回放时比较这部分
+func (r *Recording) Outputs() []*room.RecordEvent {
+	var out []*room.RecordEvent
+	for _, e := range r.Events {
+		if e.Kind.IsOutput() {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Encoder 把事件编码到 w，调用方负责 Flush
+type Encoder struct {
+	w    *bufio.Writer
+	last time.Time
+	buf  []byte
+}
+
+// NewEncoder 写入文件头
+func NewEncoder(w io.Writer, h *Header) (*Encoder, error) {
+	info, err := json.Marshal(h.MatchInfo)
+	if err != nil {
+		return nil, err
+	}
+	e := &Encoder{w: bufio.NewWriter(w)}
+	e.buf = append(e.buf, magic...)
+	e.buf = append(e.buf, version)
+	e.buf = binary.AppendVarint(e.buf, h.RoomID)
+	e.buf = appendBytes(e.buf, info)
+	if _, err := e.w.Write(e.buf); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *Encoder) Encode(ev *room.RecordEvent) error {
+	b := e.buf[:0]
+	if e.last.IsZero() {
+		b = binary.AppendVarint(b, ev.At.UnixNano())
+	} else {
+		b = binary.AppendVarint(b, int64(ev.At.Sub(e.last)))
+	}
+	e.last = ev.At
+	b = append(b, byte(ev.Kind))
+	b = binary.AppendVarint(b, ev.UID)
+	b = appendBytes(b, []byte(ev.Name))
+	b = binary.AppendUvarint(b, uint64(ev.Code))
+	b = appendBytes(b, ev.Data)
+	e.buf = b
+	_, err := e.w.Write(b)
+	return err
+}
+
+func (e *Encoder) Flush() error {
+	return e.w.Flush()
+}
+
+func appendBytes(b, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// Decoder 从 r 中依次读取事件
+type Decoder struct {
+	r    *bufio.Reader
+	last time.Time
+}
+
+// NewDecoder 读取并校验文件头
+func NewDecoder(r io.Reader) (*Decoder, *Header, error) {
+	d := &Decoder{r: bufio.NewReader(r)}
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(d.r, head); err != nil {
+		return nil, nil, ErrBadMagic
+	}
+	if string(head[:len(magic)]) != magic {
+		return nil, nil, ErrBadMagic
+	}
+	if head[len(magic)] != version {
+		return nil, nil, fmt.Errorf("%w: %d", ErrBadVersion, head[len(magic)])
+	}
+	roomID, err := binary.ReadVarint(d.r)
+	if err != nil {
+		return nil, nil, ErrTruncated
+	}
+	info, err := d.readBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	h := &Header{RoomID: roomID}
+	if err := json.Unmarshal(info, &h.MatchInfo); err != nil {
+		return nil, nil, err
+	}
+	return d, h, nil
+}
+
+// Decode 读取下一条事件，读完时返回 io.EOF，最后一条记录不完整时返回 ErrTruncated
+func (d *Decoder) Decode() (*room.RecordEvent, error) {
+	at, err := binary.ReadVarint(d.r)
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	ev := new(room.RecordEvent)
+	if d.last.IsZero() {
+		ev.At = time.Unix(0, at)
+	} else {
+		ev.At = d.last.Add(time.Duration(at))
+	}
+	kind, err := d.r.ReadByte()
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	ev.Kind = room.RecordKind(kind)
+	if ev.UID, err = binary.ReadVarint(d.r); err != nil {
+		return nil, ErrTruncated
+	}
+	name, err := d.readBytes()
+	if err != nil {
+		return nil, err
+	}
+	ev.Name = string(name)
+	code, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	ev.Code = uint32(code)
+	if ev.Data, err = d.readBytes(); err != nil {
+		return nil, err
+	}
+	d.last = ev.At
+	return ev, nil
+}
+
+func (d *Decoder) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		return nil, ErrTruncated
+	}
+	if n > maxFieldSize {
+		return nil, fmt.Errorf("replay: field too large: %d", n)
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(d.r, b); err != nil {
+		return nil, ErrTruncated
+	}
+	return b, nil
+}
+
+// ReadFile 读取录制文件，文件末尾不完整时返回已经读到的部分和 ErrTruncated
+func ReadFile(path string) (*Recording, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	d, h, err := NewDecoder(f)
+	if err != nil {
+		return nil, err
+	}
+	rec := &Recording{Header: *h}
+	for {
+		ev, err := d.Decode()
+		if err == io.EOF {
+			return rec, nil
+		}
+		if err != nil {
+			return rec, err
+		}
+		rec.Events = append(rec.Events, ev)
+	}
+}
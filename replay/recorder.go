@@ -0,0 +1,102 @@
+package replay
+
+import (
+	"game_actor/match"
+	"game_actor/room"
+	"log"
+	"os"
+	"slices"
+	"sync"
+)
+
+// FileRecorder 把房间事件追加写入录制文件，实现 room.Recorder
+// 房间 actor 停止后 RoomActor 会调用 Close
+type FileRecorder struct {
+	mu     sync.Mutex
+	path   string
+	file   *os.File
+	enc    *Encoder
+	closed bool
+	// 写入失败后不再写入，只记录一次日志
+	failed bool
+}
+
+// NewFileRecorder 创建新的录制文件，文件已经存在时返回错误
+func NewFileRecorder(path string, roomID int64, matchInfo *match.MatchInfo) (*FileRecorder, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := NewEncoder(file, &Header{RoomID: roomID, MatchInfo: matchInfo})
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &FileRecorder{
+		path: path,
+		file: file,
+		enc:  enc,
+	}, nil
+}
+
+func (r *FileRecorder) Record(e *room.RecordEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || r.failed {
+		return
+	}
+	err := r.enc.Encode(e)
+	// 状态切换不频繁，及时落盘，崩溃时尽量保留生命周期事件
+	if err == nil && e.Kind == room.RecordState {
+		err = r.enc.Flush()
+	}
+	if err != nil {
+		r.failed = true
+		log.Printf("Replay record to %s error: %v", r.path, err)
+	}
+}
+
+func (r *FileRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if err := r.enc.Flush(); err != nil {
+		r.file.Close()
+		return err
+	}
+	return r.file.Close()
+}
+
+// MemoryRecorder 把事件保存在内存中，用于测试和回放
+type MemoryRecorder struct {
+	mu  sync.Mutex
+	rec Recording
+}
+
+func NewMemoryRecorder(roomID int64, matchInfo *match.MatchInfo) *MemoryRecorder {
+	return &MemoryRecorder{
+		rec: Recording{Header: Header{RoomID: roomID, MatchInfo: matchInfo}},
+	}
+}
+
+func (r *MemoryRecorder) Record(e *room.RecordEvent) {
+	ev := *e
+	// 广播的消息可能被调用方复用
+	ev.Data = slices.Clone(e.Data)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rec.Events = append(r.rec.Events, &ev)
+}
+
+// Recording 到目前为止的录制
+func (r *MemoryRecorder) Recording() *Recording {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &Recording{
+		Header: r.rec.Header,
+		Events: slices.Clone(r.rec.Events),
+	}
+}
@@ -1,11 +1,15 @@
 package room
 
 import (
-	"fmt"
+	"errors"
+	"game_actor/clock"
+	"game_actor/codec"
 	"game_actor/match"
 	"game_actor/session"
+	"game_actor/settle"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/samber/lo"
 )
@@ -16,13 +20,55 @@ const (
 	RoomStatus_Close = 2
 )
 
+// roomTimers 房间内的定时器，RoomActor 使用 actor 的定时器实现
+type roomTimers interface {
+	AfterFunc(d time.Duration, f func()) *Timer
+	PauseTimers()
+	ResumeTimers()
+}
+
+var ErrRoomClosed = errors.New("room already closed")
+
 type BaseRoom struct {
 	Status    atomic.Int32
 	RoomID    int64
 	matchInfo *match.MatchInfo
 	players   sync.Map
-	channels  sync.Map // channelID (string) -> *Channel
+	channels  sync.Map // ChannelID -> *Channel
+	offline   sync.Map // uid -> session.Session，断线保留期内的旧 session
 	playerNum atomic.Int32
+	// 暂停投票，只在 actor goroutine 中访问
+	pauseVotes map[int64]bool
+	// 房间定时器，由 RoomActor 设置，BaseRoom 单独使用时为空
+	timers roomTimers
+	// 观战者，uid -> session.Session
+	spectators   sync.Map
+	spectatorNum atomic.Int32
+	// 观战延迟广播队列，只在 actor goroutine 中访问
+	spectatorQueue []delayedMsg
+	// 对局结果，只在 actor goroutine 中访问
+	result  *settle.Result
+	settled bool
+	// 关闭原因和自动关闭，只在 actor goroutine 中访问
+	closeReason CloseReason
+	emptyTimer  *Timer
+	// 房间自己发起关闭时调用，由 RoomActor 设置
+	closer func(reason CloseReason)
+	// 在 actor goroutine 中执行 f，由 RoomActor 设置，用于后台任务把结果交回房间
+	invoker func(f func()) error
+	// 用户进入或离开房间后调用，一般由 RoomService 设置，见 SetMemberHandler
+	memberHandler atomic.Pointer[func(roomID int64, uid int64, entered bool)]
+	// 状态切换后调用，一般由 RoomService 设置，见 SetStateHandler
+	stateHandler atomic.Pointer[func(roomID int64, from, to int32)]
+	// 创建和开始游戏的时间，快照恢复时用于计算剩余时间
+	createdAt time.Time
+	startedAt time.Time
+	// 累计暂停的时长（不包括正在进行的暂停）和本次暂停开始的时间，只在 actor goroutine 中访问
+	pausedTotal time.Duration
+	pausedAt    time.Time
+	// 快照序号，只在 actor goroutine 中访问；snapshots 在设置了 WithSnapshot 时由 RoomActor 创建
+	snapshotSeq uint64
+	snapshots   *snapshotSaver
 
 	option *Option
 }
@@ -37,6 +83,7 @@ func NewBaseRoom(roomID int64, matchInfo *match.MatchInfo, opts ...OptionFunc) *
 	baseRoom.matchInfo = matchInfo
 	baseRoom.Status.Store(RoomStatus_Init)
 	baseRoom.option = opt
+	baseRoom.createdAt = baseRoom.now()
 	return baseRoom
 }
 
@@ -48,71 +95,66 @@ func (r *BaseRoom) GetMatchInfo() *match.MatchInfo {
 	return r.matchInfo
 }
 
-// 检查房间是否有玩家
+// 检查房间玩家数是否达到 AutoClose.MinPlayers，并且当前状态可以开始游戏
 func (r *BaseRoom) Check() bool {
-	return r.Status.Load() == RoomStatus_Init && r.playerNum.Load() > 0
+	status := r.Status.Load()
+	return status != RoomStatus_Paused && r.stateMachine().CanTransition(status, RoomStatus_Start) && r.playerNum.Load() >= r.minPlayers()
 }
 
-func (r *BaseRoom) Start() bool {
-	if !r.Status.CompareAndSwap(RoomStatus_Init, RoomStatus_Start) {
-		return false
-	}
-	// 游戏开始,这里需要通知游戏房游戏开始了
-	for _, opt := range r.option.roomOpts {
-		opt.OnStart(r.RoomID)
-	}
-	return true
+// Start 开始游戏，通过 RoomOption.OnStart 通知游戏房
+func (r *BaseRoom) Start() error {
+	return r.Transition(RoomStatus_Start)
 }
 
-func (r *BaseRoom) Close() {
-	if !r.Status.CompareAndSwap(RoomStatus_Start, RoomStatus_Close) {
-		return
-	}
-	// 游戏结束，这里需要通知游戏结束了
-	for _, opt := range r.option.roomOpts {
-		opt.OnClose(r.RoomID)
+// Close 结束游戏，通过 RoomOption.OnClose 通知游戏房，任何状态都可以关闭
+func (r *BaseRoom) Close(reason CloseReason) error {
+	if r.Status.Load() == RoomStatus_Close {
+		return ErrRoomClosed
 	}
+	r.closeReason = reason
+	r.stopEmptyTimer()
+	return r.Transition(RoomStatus_Close)
 }
 
 func (r *BaseRoom) UserEnterRoom(uid int64, roomID int64, sess session.Session) {
-	// 绑定 Session 到默认频道（RoomID）
 	if sess != nil {
-		channelID := fmt.Sprintf("%d", roomID)
-		r.JoinChannel(channelID, uid, sess)
+		// 断线重连，新 session 替换旧 session，座位保持不变
+		if r.reconnect(uid, sess) {
+			return
+		}
+		// 绑定 Session 到默认频道（RoomID）
+		r.JoinChannel(RoomChannel(roomID), uid, sess)
+		// 玩家同时加入自己的阵营频道
+		if camp, ok := r.campOf(uid); ok {
+			r.JoinChannel(CampChannel(roomID, camp), uid, sess)
+		}
 	}
 
 	// 玩家已经进入了
 	if _, loaded := r.players.LoadOrStore(uid, true); loaded {
 		return
 	}
-	// 只有初始化状态才能加入(玩家)，初始阶段不能进入观众？
-	if r.Status.Load() != RoomStatus_Init {
-		isPlayer := lo.ContainsBy(r.matchInfo.Players, func(player *match.Player) bool {
-			return player.PlayerUID == uid
-		})
-		// 不是玩家，直接返回
-		if !isPlayer {
-			return
-		}
-		// 游戏玩家
-		_, loaded := r.players.LoadOrStore(uid, true)
-		if loaded {
-			return
-		}
+	r.notifyMember(uid, true)
+	// 游戏玩家
+	if r.isPlayer(uid) {
 		r.playerNum.Add(1)
 		r.playerEnter(uid)
 		return
 	}
-	// 玩家进入了，这里需要通知游戏房玩家进入了
+	// 非玩家进入了，这里需要通知游戏房
 	for _, opt := range r.option.playerOpts {
 		opt.OnEnter(uid, false)
 	}
 }
 
 func (r *BaseRoom) KickUser(uid int64) {
+	if val, ok := r.spectators.Load(uid); ok {
+		val.(session.Session).Close()
+		r.SpectatorLeave(uid)
+		return
+	}
 	// 从默认频道获取 Session 并关闭
-	channelID := fmt.Sprintf("%d", r.RoomID)
-	if val, ok := r.channels.Load(channelID); ok {
+	if val, ok := r.channels.Load(RoomChannel(r.RoomID)); ok {
 		channel := val.(*Channel)
 		if sess, ok := channel.GetSession(uid); ok {
 			sess.Close()
@@ -122,49 +164,241 @@ func (r *BaseRoom) KickUser(uid int64) {
 }
 
 func (r *BaseRoom) UserLeaveRoom(uid int64, roomID int64) {
-	// 移除 Session (默认从 RoomID 频道移除)
-	channelID := fmt.Sprintf("%d", roomID)
-	r.LeaveChannel(channelID, uid)
+	if r.IsSpectator(uid) {
+		r.SpectatorLeave(uid)
+		return
+	}
+	// 移除 Session (默认从 RoomID 频道和阵营频道移除)
+	r.LeaveChannel(RoomChannel(roomID), uid)
+	if camp, ok := r.campOf(uid); ok {
+		r.LeaveChannel(CampChannel(roomID, camp), uid)
+	}
+	r.offline.Delete(uid)
 
-	// 判断是否是玩家
-	isPlayer := lo.ContainsBy(r.matchInfo.Players, func(player *match.Player) bool {
-		return player.PlayerUID == uid
-	})
+	// 已经离开了
+	if _, loaded := r.players.LoadAndDelete(uid); !loaded {
+		return
+	}
+	r.notifyMember(uid, false)
 
-	// 如果是玩家，需要从 map 中移除并减少人数
+	// 如果是玩家，需要减少人数
+	isPlayer := r.isPlayer(uid)
 	if isPlayer {
-		if _, loaded := r.players.LoadAndDelete(uid); loaded {
-			r.playerNum.Add(-1)
-		}
+		r.playerNum.Add(-1)
+		delete(r.pauseVotes, uid)
 	}
 
 	// 玩家离开了，这里需要通知游戏房玩家离开了
 	for _, opt := range r.option.playerOpts {
 		opt.OnLeave(uid, isPlayer)
 	}
+	if isPlayer {
+		r.onPlayerLeave(uid)
+	}
+}
+
+// SetMemberHandler 设置用户进入（不包括断线重连和观战）或离开房间（包括断线超时、被踢和观战者离开）后的回调
+// 在 actor goroutine 中按发生顺序调用，RoomService 创建房间时设置，用于维护用户所在的房间
+func (r *BaseRoom) SetMemberHandler(h func(roomID int64, uid int64, entered bool)) {
+	r.memberHandler.Store(&h)
+}
+
+func (r *BaseRoom) notifyMember(uid int64, entered bool) {
+	if h := r.memberHandler.Load(); h != nil {
+		(*h)(r.RoomID, uid, entered)
+	}
 }
 
-func (r *BaseRoom) JoinChannel(channelID string, uid int64, sess session.Session) {
+// UserDisconnect 连接断开，返回重连保留时间
+// 保留期内玩家仍在 players 中，座位和阵营不变；返回 0 表示已直接离开房间
+func (r *BaseRoom) UserDisconnect(uid int64, sess session.Session) time.Duration {
+	// 观战者断线直接离开，不保留
+	if cur, ok := r.spectators.Load(uid); ok {
+		if cur == sess {
+			r.SpectatorLeave(uid)
+		}
+		return 0
+	}
+	// 只处理当前绑定的 session，被替换掉的旧连接断开不影响房间
+	cur, ok := r.defaultChannel().GetSession(uid)
+	if !ok || cur != sess {
+		return 0
+	}
+	grace := r.reconnectGrace()
+	if grace <= 0 || !r.isPlayer(uid) {
+		r.UserLeaveRoom(uid, r.RoomID)
+		return 0
+	}
+	r.offline.Store(uid, sess)
+	// 断线的玩家不再计入暂停投票，重连后需要重新投票
+	delete(r.pauseVotes, uid)
+	for _, opt := range r.option.roomOpts {
+		opt.OnDisconnect(r.RoomID, uid)
+	}
+	return grace
+}
+
+// expireDisconnect 保留期结束仍未重连，玩家离开房间
+func (r *BaseRoom) expireDisconnect(uid int64, sess session.Session) {
+	if old, ok := r.offline.Load(uid); !ok || old != sess {
+		return
+	}
+	r.UserLeaveRoom(uid, r.RoomID)
+}
+
+// reconnect 用新 session 替换旧 session 所在的所有频道
+func (r *BaseRoom) reconnect(uid int64, sess session.Session) bool {
+	var old session.Session
+	if val, ok := r.offline.LoadAndDelete(uid); ok {
+		old = val.(session.Session)
+	} else if cur, ok := r.defaultChannel().GetSession(uid); ok && cur != sess {
+		// 旧连接还没检测到断开就重新进入了
+		old = cur
+	} else {
+		return false
+	}
+
+	r.channels.Range(func(key, value any) bool {
+		channel := value.(*Channel)
+		if cur, ok := channel.GetSession(uid); ok && cur == old {
+			channel.Add(uid, sess)
+		}
+		return true
+	})
+	old.Close()
+
+	for _, opt := range r.option.roomOpts {
+		opt.OnReconnect(r.RoomID, uid)
+	}
+	return true
+}
+
+func (r *BaseRoom) reconnectGrace() time.Duration {
+	if r.option.reconnectGrace > 0 {
+		return r.option.reconnectGrace
+	}
+	if r.matchInfo != nil && r.matchInfo.ReconnectGraceTime > 0 {
+		return time.Duration(r.matchInfo.ReconnectGraceTime) * time.Second
+	}
+	return 0
+}
+
+// clock 房间使用的时钟，默认为系统时钟
+func (r *BaseRoom) clock() clock.Clock {
+	if r.option.clock != nil {
+		return r.option.clock
+	}
+	return clock.Real
+}
+
+func (r *BaseRoom) now() time.Time {
+	return r.clock().Now()
+}
+
+func (r *BaseRoom) isPlayer(uid int64) bool {
+	if r.matchInfo == nil {
+		return false
+	}
+	return lo.ContainsBy(r.matchInfo.Players, func(player *match.Player) bool {
+		return player.PlayerUID == uid
+	})
+}
+
+// campOf 玩家的阵营，非玩家返回 false
+func (r *BaseRoom) campOf(uid int64) (int32, bool) {
+	if r.matchInfo == nil {
+		return 0, false
+	}
+	player, ok := lo.Find(r.matchInfo.Players, func(player *match.Player) bool {
+		return player.PlayerUID == uid
+	})
+	if !ok {
+		return 0, false
+	}
+	return player.Camp, true
+}
+
+func (r *BaseRoom) defaultChannel() *Channel {
+	channelID := RoomChannel(r.RoomID)
+	val, _ := r.channels.LoadOrStore(channelID, NewChannel(channelID))
+	return val.(*Channel)
+}
+
+func (r *BaseRoom) JoinChannel(channelID ChannelID, uid int64, sess session.Session) {
 	val, _ := r.channels.LoadOrStore(channelID, NewChannel(channelID))
 	channel := val.(*Channel)
 	channel.Add(uid, sess)
 }
 
-func (r *BaseRoom) LeaveChannel(channelID string, uid int64) {
+func (r *BaseRoom) LeaveChannel(channelID ChannelID, uid int64) {
 	if val, ok := r.channels.Load(channelID); ok {
 		channel := val.(*Channel)
 		channel.Remove(uid)
 	}
 }
 
-func (r *BaseRoom) Broadcast(channelID string, msg []byte) {
+func (r *BaseRoom) Broadcast(channelID ChannelID, msg []byte) {
+	r.record(RecordOutbound, 0, string(channelID), 0, msg)
 	if val, ok := r.channels.Load(channelID); ok {
 		channel := val.(*Channel)
 		channel.Broadcast(msg)
 	}
+	// 发给玩家的消息同时延迟转发给观战者
+	if channelID == RoomChannel(r.RoomID) {
+		r.feedSpectators(msg)
+	}
+}
+
+// BroadcastPayload 转发 uid 发来的消息，payload 是已经编码好的业务数据，原样放进信封
+// 信封按接收者连接的 Codec 编码，route 和发送者 uid 放在信封中，接收者需要和发送者使用相同格式的业务数据
+func (r *BaseRoom) BroadcastPayload(channelID ChannelID, uid int64, route string, payload []byte) {
+	e := newEvent(r.RoomID, route, rawPayload(payload))
+	e.uid = uid
+	r.broadcastEvent(channelID, e)
+}
+
+// broadcastEvent 按接收者的 Codec 编码后广播，录制时使用 JSON 编码
+func (r *BaseRoom) broadcastEvent(channelID ChannelID, e *event) {
+	r.record(RecordOutbound, 0, string(channelID), 0, e.encode(codec.JSON))
+	if val, ok := r.channels.Load(channelID); ok {
+		val.(*Channel).broadcastEvent(e)
+	}
+	if channelID == RoomChannel(r.RoomID) {
+		r.feedSpectatorEvent(e)
+	}
+}
+
+// BroadcastExcept 广播给频道中除 except 之外的用户
+func (r *BaseRoom) BroadcastExcept(channelID ChannelID, msg []byte, except ...int64) {
+	r.record(RecordOutbound, 0, string(channelID), 0, msg)
+	if val, ok := r.channels.Load(channelID); ok {
+		channel := val.(*Channel)
+		channel.BroadcastExcept(msg, except...)
+	}
+	if channelID == RoomChannel(r.RoomID) {
+		r.feedSpectators(msg)
+	}
+}
+
+// BroadcastToCamp 广播给阵营内的玩家，观战者收不到
+func (r *BaseRoom) BroadcastToCamp(camp int32, msg []byte) {
+	r.Broadcast(CampChannel(r.RoomID, camp), msg)
+}
+
+// SendTo 单独发送给房间内的某个用户（玩家或观战者），用户不在房间时忽略
+func (r *BaseRoom) SendTo(uid int64, msg []byte) {
+	r.record(RecordOutbound, uid, "", 0, msg)
+	if sess, ok := r.defaultChannel().GetSession(uid); ok {
+		sess.Send(msg)
+		return
+	}
+	if val, ok := r.spectators.Load(uid); ok {
+		val.(session.Session).Send(msg)
+	}
 }
 
 func (r *BaseRoom) playerEnter(uid int64) {
+	r.stopEmptyTimer()
 	// 玩家进入了，这里需要通知游戏房玩家进入了
 	for _, opt := range r.option.playerOpts {
 		opt.OnEnter(uid, true)
@@ -174,3 +408,9 @@ func (r *BaseRoom) playerEnter(uid int64) {
 		r.Start()
 	}
 }
+
+func (r *BaseRoom) tick(dt time.Duration, frame uint64) {
+	for _, opt := range r.option.tickOpts {
+		opt.OnTick(dt, frame)
+	}
+}
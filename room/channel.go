@@ -1,16 +1,36 @@
 package room
 
 import (
+	"fmt"
 	"game_actor/session"
+	"slices"
 	"sync"
 )
 
+// ChannelID 频道 ID，使用 RoomChannel/CampChannel/SpectatorChannel 生成，不需要手动拼接
+type ChannelID string
+
+// RoomChannel 房间默认频道，所有进入房间的用户都在这个频道中
+func RoomChannel(roomID int64) ChannelID {
+	return ChannelID(fmt.Sprintf("%d", roomID))
+}
+
+// CampChannel 阵营频道，玩家进入房间时按 match.Player.Camp 自动加入
+func CampChannel(roomID int64, camp int32) ChannelID {
+	return ChannelID(fmt.Sprintf("%d:camp:%d", roomID, camp))
+}
+
+// SpectatorChannel 观战频道，发送到房间默认频道的消息延迟后转发到这里
+func SpectatorChannel(roomID int64) ChannelID {
+	return ChannelID(fmt.Sprintf("%d:spectator", roomID))
+}
+
 type Channel struct {
-	ID       string
+	ID       ChannelID
 	sessions sync.Map // uid -> session.Session
 }
 
-func NewChannel(id string) *Channel {
+func NewChannel(id ChannelID) *Channel {
 	return &Channel{
 		ID: id,
 	}
@@ -40,3 +60,28 @@ func (c *Channel) Broadcast(msg []byte) {
 		return true
 	})
 }
+
+// BroadcastExcept 广播给频道中除 except 之外的用户
+func (c *Channel) BroadcastExcept(msg []byte, except ...int64) {
+	c.sessions.Range(func(key, value any) bool {
+		if slices.Contains(except, key.(int64)) {
+			return true
+		}
+		sess, ok := value.(session.Session)
+		if ok {
+			sess.Send(msg)
+		}
+		return true
+	})
+}
+
+// broadcastEvent 按每个 session 的 Codec 编码后广播
+func (c *Channel) broadcastEvent(e *event) {
+	c.sessions.Range(func(key, value any) bool {
+		sess, ok := value.(session.Session)
+		if ok {
+			e.sendTo(sess)
+		}
+		return true
+	})
+}
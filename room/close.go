@@ -0,0 +1,142 @@
+package room
+
+import (
+	"fmt"
+	"game_actor/settle"
+	"time"
+)
+
+// CloseReason 房间关闭原因
+type CloseReason int32
+
+const (
+	// 游戏正常结束
+	CloseNormal CloseReason = iota
+	// 超过 MaxGameTime
+	CloseTimeout
+	// 后台或运维关闭
+	CloseAdmin
+	// 所有玩家离开
+	CloseAbandon
+	// 游戏开始后有阵营没有玩家
+	CloseCampEmpty
+	// 到达 MaxPlayerWaitTime 时人数不足，无法开始
+	CloseNotEnoughPlayers
+	// panic 等异常
+	CloseCrash
+)
+
+func (c CloseReason) String() string {
+	switch c {
+	case CloseNormal:
+		return "normal"
+	case CloseTimeout:
+		return "timeout"
+	case CloseAdmin:
+		return "admin"
+	case CloseAbandon:
+		return "abandon"
+	case CloseCampEmpty:
+		return "camp_empty"
+	case CloseNotEnoughPlayers:
+		return "not_enough_players"
+	case CloseCrash:
+		return "crash"
+	}
+	return fmt.Sprintf("close_reason(%d)", int32(c))
+}
+
+// SettleReason 对应的结算原因
+func (c CloseReason) SettleReason() settle.Reason {
+	switch c {
+	case CloseNormal:
+		return settle.ReasonNormal
+	case CloseTimeout:
+		return settle.ReasonTimeout
+	case CloseCrash:
+		return settle.ReasonCrash
+	}
+	return settle.ReasonAbandon
+}
+
+// AutoClose 自动关闭规则，零值表示不开启
+type AutoClose struct {
+	// 所有玩家离开（断线保留期内的玩家不算离开）持续多久后关闭
+	EmptyTimeout time.Duration
+	// 游戏开始后有阵营没有玩家时关闭，只在 MatchInfo 中有多个阵营时生效
+	CampEmpty bool
+	// 开始游戏需要的最少玩家数，到达 MaxPlayerWaitTime 时不足则关闭，0 表示至少 1 人
+	MinPlayers int
+}
+
+// CloseReason 房间的关闭原因，房间未关闭时为 CloseNormal
+// 可以在 RoomOption.OnClose 中获取
+func (r *BaseRoom) CloseReason() CloseReason {
+	return r.closeReason
+}
+
+// requestClose 房间自己发起关闭，RoomActor 中会走 RoomService.CloseRoom 清理调度任务
+func (r *BaseRoom) requestClose(reason CloseReason) {
+	if r.closer != nil {
+		r.closer(reason)
+		return
+	}
+	r.Close(reason)
+}
+
+// onPlayerLeave 玩家离开后检查自动关闭规则
+func (r *BaseRoom) onPlayerLeave(uid int64) {
+	rule := r.option.autoClose
+	if rule.CampEmpty && r.campEmpty(uid) {
+		r.requestClose(CloseCampEmpty)
+		return
+	}
+	if rule.EmptyTimeout > 0 && r.playerNum.Load() == 0 && r.timers != nil {
+		r.stopEmptyTimer()
+		r.emptyTimer = r.timers.AfterFunc(rule.EmptyTimeout, func() {
+			r.emptyTimer = nil
+			if r.playerNum.Load() == 0 {
+				r.requestClose(CloseAbandon)
+			}
+		})
+	}
+}
+
+func (r *BaseRoom) stopEmptyTimer() {
+	if r.emptyTimer != nil {
+		r.emptyTimer.Stop()
+		r.emptyTimer = nil
+	}
+}
+
+// campEmpty 离开的玩家所在阵营是否已经没有玩家，只在游戏进行中检查
+func (r *BaseRoom) campEmpty(uid int64) bool {
+	status := r.Status.Load()
+	if status != RoomStatus_Start && status != RoomStatus_Paused {
+		return false
+	}
+	camp, ok := r.campOf(uid)
+	if !ok {
+		return false
+	}
+	camps := make(map[int32]bool)
+	for _, player := range r.matchInfo.Players {
+		camps[player.Camp] = true
+	}
+	if len(camps) < 2 {
+		return false
+	}
+	empty := true
+	r.players.Range(func(key, value any) bool {
+		if c, ok := r.campOf(key.(int64)); ok && c == camp {
+			empty = false
+			return false
+		}
+		return true
+	})
+	return empty
+}
+
+func (r *BaseRoom) minPlayers() int32 {
+	return int32(max(r.option.autoClose.MinPlayers, 1))
+}
@@ -0,0 +1,59 @@
+package room
+
+import (
+	"game_actor/codec"
+	"game_actor/session"
+	"log"
+)
+
+// event 房间推送给客户端的事件，按接收者连接的 Codec 编码，同一个 Codec 只编码一次
+// payload 在 protobuf 连接上需要实现 codec.WireMarshaler，字段定义见 envelope.proto
+type event struct {
+	roomID int64
+	// 消息的发送者，房间自己发出的事件为 0
+	uid     int64
+	route   string
+	payload any
+	encoded map[string][]byte
+}
+
+func newEvent(roomID int64, route string, payload any) *event {
+	return &event{roomID: roomID, route: route, payload: payload}
+}
+
+// rawPayload 已经编码好的业务数据，如客户端转发的消息，直接放进信封，不再 Marshal
+type rawPayload []byte
+
+// encode 编码失败时返回 nil，调用方跳过该连接
+func (e *event) encode(c codec.Codec) []byte {
+	if msg, ok := e.encoded[c.Name()]; ok {
+		return msg
+	}
+	msg, err := e.marshal(c)
+	if err != nil {
+		log.Printf("Room %d encode %s event with %s error: %v", e.roomID, e.route, c.Name(), err)
+	}
+	if e.encoded == nil {
+		e.encoded = make(map[string][]byte)
+	}
+	e.encoded[c.Name()] = msg
+	return msg
+}
+
+func (e *event) marshal(c codec.Codec) ([]byte, error) {
+	payload, ok := e.payload.(rawPayload)
+	if !ok {
+		var err error
+		if payload, err = c.Marshal(e.payload); err != nil {
+			return nil, err
+		}
+	}
+	return c.Encode(&codec.Envelope{Route: e.route, RoomID: e.roomID, UID: e.uid, Payload: payload})
+}
+
+// sendTo 按 session 的 Codec 编码后发送
+func (e *event) sendTo(sess session.Session) {
+	if msg := e.encode(codec.FromSession(sess)); msg != nil {
+		sess.Send(msg)
+	}
+}
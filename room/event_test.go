@@ -0,0 +1,37 @@
+package room_test
+
+import (
+	"game_actor/codec"
+	"game_actor/match"
+	"game_actor/room"
+	"testing"
+)
+
+// 转发的消息按每个接收者连接的 Codec 封装信封，Payload 原样保留
+func TestBroadcastPayload(t *testing.T) {
+	matchInfo := &match.MatchInfo{Players: []*match.Player{{PlayerUID: 1}, {PlayerUID: 2}}}
+	r := room.NewRoomActor(1, matchInfo)
+	t.Cleanup(func() { r.Close(room.CloseAdmin) })
+	sessions := []*testSession{{uid: 1, codec: codec.JSON}, {uid: 2, codec: codec.Proto}}
+	for _, sess := range sessions {
+		r.UserEnterRoom(sess.uid, 1, sess)
+	}
+	payload := []byte(`{"text":"hi"}`)
+	r.BroadcastPayload(room.RoomChannel(1), 1, "message", payload)
+	if err := r.Actor().RunPending(); err != nil {
+		t.Fatalf("run pending: %v", err)
+	}
+
+	for _, sess := range sessions {
+		if len(sess.sent) != 1 {
+			t.Fatalf("player %d received %d messages, want 1", sess.uid, len(sess.sent))
+		}
+		env, err := sess.codec.Decode(sess.sent[0])
+		if err != nil {
+			t.Fatalf("player %d decode: %v", sess.uid, err)
+		}
+		if env.Route != "message" || env.RoomID != 1 || env.UID != 1 || string(env.Payload) != string(payload) {
+			t.Fatalf("player %d received %+v", sess.uid, env)
+		}
+	}
+}
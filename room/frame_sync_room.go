@@ -0,0 +1,225 @@
+package room
+
+import (
+	"encoding/json"
+	"errors"
+	"game_actor/match"
+	"log"
+	"slices"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// 客户端最多可以提前提交的帧数，防止伪造的帧号撑大 pending
+	maxFrameInputAhead = 64
+	// 默认保留的历史帧数，20 帧每秒时约 5 分钟
+	defaultFrameHistory = 6000
+)
+
+// ErrFramesDiscarded 请求的帧早于保留的历史帧，客户端需要通过其他方式（如游戏状态快照）恢复
+var ErrFramesDiscarded = errors.New("frames already discarded")
+
+// FrameInput 玩家在某一帧的输入，Data 为空表示该玩家本帧没有输入（迟到或缺席）
+type FrameInput struct {
+	UID  int64  `json:"uid"`
+	Data []byte `json:"data,omitempty"`
+}
+
+// Frame 一个逻辑帧内所有玩家合并后的输入
+type Frame struct {
+	Frame  uint64        `json:"frame"`
+	Inputs []*FrameInput `json:"inputs"`
+}
+
+// frameEvent 下发给客户端的帧消息（route 为 frame），实时帧和补帧使用同一格式
+// 按连接的 Codec 编码，protobuf 格式见 envelope.proto 中的 FrameEvent
+type frameEvent struct {
+	Frames []*Frame `json:"frames"`
+}
+
+func (e *frameEvent) MarshalWire() []byte {
+	var b []byte
+	for _, f := range e.Frames {
+		var fb []byte
+		fb = protowire.AppendTag(fb, 1, protowire.VarintType)
+		fb = protowire.AppendVarint(fb, f.Frame)
+		for _, input := range f.Inputs {
+			var ib []byte
+			ib = protowire.AppendTag(ib, 1, protowire.VarintType)
+			ib = protowire.AppendVarint(ib, uint64(input.UID))
+			if len(input.Data) > 0 {
+				ib = protowire.AppendTag(ib, 2, protowire.BytesType)
+				ib = protowire.AppendBytes(ib, input.Data)
+			}
+			fb = protowire.AppendTag(fb, 2, protowire.BytesType)
+			fb = protowire.AppendBytes(fb, ib)
+		}
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, fb)
+	}
+	return b
+}
+
+// frameSyncState 帧同步房间的快照，Frames 从第 Base+1 帧开始
+type frameSyncState struct {
+	Base    uint64                   `json:"base,omitempty"`
+	Frames  []*Frame                 `json:"frames"`
+	Pending map[uint64][]*FrameInput `json:"pending,omitempty"`
+}
+
+// FrameSyncRoom 帧同步（lockstep）房间
+// 每个 tick 收集玩家输入并合并成一帧广播到默认频道，没有输入的玩家补空输入
+type FrameSyncRoom struct {
+	*RoomActor
+	// 以下字段只在 actor goroutine 中访问
+	pending map[uint64][]*FrameInput // frame -> 已收到的输入，每个玩家最多一条
+	frames  []*Frame                 // 保留的历史帧，下标为 frame-base-1
+	base    uint64                   // 已经丢弃的帧数
+	history int                      // 最多保留的历史帧数，见 WithFrameHistory
+}
+
+func NewFrameSyncRoom(roomID int64, matchInfo *match.MatchInfo, hz int, opts ...OptionFunc) *FrameSyncRoom {
+	r := &FrameSyncRoom{
+		pending: make(map[uint64][]*FrameInput),
+	}
+	opts = append(opts, WithTickRate(hz), WithTickOption(r), WithSnapshotter(r))
+	r.RoomActor = NewRoomActor(roomID, matchInfo, opts...)
+	r.history = r.option.frameHistory
+	if r.history <= 0 {
+		r.history = defaultFrameHistory
+	}
+	return r
+}
+
+// SubmitInput 提交玩家在指定帧的输入，只接受对局中的玩家，其他用户返回 ErrNotPlayer
+// 目标帧已经下发（迟到）时，输入顺延到下一帧；同一帧重复提交时以最后一次为准
+func (r *FrameSyncRoom) SubmitInput(uid int64, frame uint64, data []byte) error {
+	if !r.isPlayer(uid) {
+		return ErrNotPlayer
+	}
+	return r.Invoke(func() {
+		next := r.currentFrame() + 1
+		if frame < next {
+			frame = next
+		}
+		if frame > next+maxFrameInputAhead {
+			log.Printf("Room %d drop input from %d: frame %d too far ahead", r.RoomID, uid, frame)
+			return
+		}
+		input := &FrameInput{UID: uid, Data: data}
+		for i, prev := range r.pending[frame] {
+			if prev.UID == uid {
+				r.pending[frame][i] = input
+				return
+			}
+		}
+		r.pending[frame] = append(r.pending[frame], input)
+	})
+}
+
+// GetFrames 获取 [from, to] 区间内的历史帧，from 为 0 表示从保留的最早一帧开始，to 为 0 表示到最新一帧
+// from 早于保留的历史帧时返回 ErrFramesDiscarded
+// 返回的是拷贝，OnTick 丢弃历史帧时不影响调用方
+func (r *FrameSyncRoom) GetFrames(from, to uint64) ([]*Frame, error) {
+	res, err := r.SyncInvoke(func() (any, error) {
+		frames, err := r.frameRange(from, to)
+		return slices.Clone(frames), err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.([]*Frame), nil
+}
+
+// SendFrames 断线重连的客户端补帧，把 [from, to] 区间内的历史帧发给指定玩家
+func (r *FrameSyncRoom) SendFrames(uid int64, from, to uint64) error {
+	return r.Invoke(func() {
+		frames, err := r.frameRange(from, to)
+		if err != nil {
+			log.Printf("Room %d send frames to %d error: %v", r.RoomID, uid, err)
+			return
+		}
+		sess, ok := r.defaultChannel().GetSession(uid)
+		if !ok {
+			return
+		}
+		newEvent(r.RoomID, "frame", &frameEvent{Frames: frames}).sendTo(sess)
+	})
+}
+
+// OnTick 合并本帧输入并广播，运行在 actor goroutine 中
+func (r *FrameSyncRoom) OnTick(dt time.Duration, frame uint64) {
+	// tick 帧号和逻辑帧号一致，由 tickLoop 保证连续递增
+	inputs := r.pending[frame]
+	delete(r.pending, frame)
+
+	// 本帧没有输入的玩家补空输入，保证每帧包含所有玩家
+	submitted := make(map[int64]bool, len(inputs))
+	for _, input := range inputs {
+		submitted[input.UID] = true
+	}
+	for _, player := range r.matchInfo.Players {
+		if !submitted[player.PlayerUID] {
+			inputs = append(inputs, &FrameInput{UID: player.PlayerUID})
+		}
+	}
+
+	f := &Frame{Frame: frame, Inputs: inputs}
+	r.frames = append(r.frames, f)
+	if over := len(r.frames) - r.history; over > 0 {
+		clear(r.frames[:over])
+		r.frames = r.frames[over:]
+		r.base += uint64(over)
+	}
+	r.broadcastEvent(RoomChannel(r.RoomID), newEvent(r.RoomID, "frame", &frameEvent{Frames: []*Frame{f}}))
+}
+
+// Snapshot 快照包含保留的历史帧，恢复后重连的玩家仍然可以补帧
+func (r *FrameSyncRoom) Snapshot() ([]byte, error) {
+	return json.Marshal(&frameSyncState{Base: r.base, Frames: r.frames, Pending: r.pending})
+}
+
+func (r *FrameSyncRoom) Restore(data []byte) error {
+	var state frameSyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	r.base = state.Base
+	r.frames = state.Frames
+	// 恢复时使用的历史帧数可能比快照时小
+	if over := len(r.frames) - r.history; over > 0 {
+		r.frames = r.frames[over:]
+		r.base += uint64(over)
+	}
+	if state.Pending != nil {
+		r.pending = state.Pending
+	}
+	return nil
+}
+
+func (r *FrameSyncRoom) currentFrame() uint64 {
+	return r.base + uint64(len(r.frames))
+}
+
+// frameRange 返回的切片和 r.frames 共用底层数组，只能在 actor goroutine 中使用
+func (r *FrameSyncRoom) frameRange(from, to uint64) ([]*Frame, error) {
+	current := r.currentFrame()
+	if from == 0 {
+		from = r.base + 1
+	}
+	if to == 0 || to > current {
+		to = current
+	}
+	if from > current {
+		return nil, nil
+	}
+	if from > to {
+		return nil, errors.New("invalid frame range")
+	}
+	if from <= r.base {
+		return nil, ErrFramesDiscarded
+	}
+	return r.frames[from-r.base-1 : to-r.base], nil
+}
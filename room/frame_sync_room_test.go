@@ -0,0 +1,164 @@
+package room_test
+
+import (
+	"errors"
+	"game_actor/clock"
+	"game_actor/codec"
+	"game_actor/match"
+	"game_actor/room"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type testSession struct {
+	uid   int64
+	codec codec.Codec
+	sent  [][]byte
+}
+
+func (s *testSession) ID() string            { return "test" }
+func (s *testSession) UserID() int64         { return s.uid }
+func (s *testSession) SetUserID(uid int64)   { s.uid = uid }
+func (s *testSession) Send(msg []byte) error { s.sent = append(s.sent, msg); return nil }
+func (s *testSession) Close() error          { return nil }
+func (s *testSession) Codec() codec.Codec    { return s.codec }
+
+// frameRoom 10 帧每秒的帧同步房间，两个玩家进入后自动开始
+type frameRoom struct {
+	r        *room.FrameSyncRoom
+	clock    *clock.Fake
+	sessions map[int64]*testSession
+}
+
+func newFrameRoom(t *testing.T, opts ...room.OptionFunc) *frameRoom {
+	t.Helper()
+	c := clock.NewFake(epoch)
+	matchInfo := &match.MatchInfo{Players: []*match.Player{{PlayerUID: 1}, {PlayerUID: 2}}}
+	r := room.NewFrameSyncRoom(1, matchInfo, 10, append(opts, room.WithClock(c))...)
+	t.Cleanup(func() { r.Close(room.CloseAdmin) })
+	fr := &frameRoom{r: r, clock: c, sessions: map[int64]*testSession{
+		1: {uid: 1, codec: codec.JSON},
+		2: {uid: 2, codec: codec.Proto},
+	}}
+	for uid, sess := range fr.sessions {
+		r.UserEnterRoom(uid, 1, sess)
+	}
+	fr.runPending(t)
+	if status := r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room status %d, want started", status)
+	}
+	return fr
+}
+
+func (fr *frameRoom) runPending(t *testing.T) {
+	t.Helper()
+	if err := fr.r.Actor().RunPending(); err != nil {
+		t.Fatalf("run pending: %v", err)
+	}
+}
+
+// tick 先执行已经提交的输入再推进 n 帧，每帧单独推进，落后超过一个周期的 tick 不会补执行
+func (fr *frameRoom) tick(t *testing.T, n int) {
+	t.Helper()
+	fr.runPending(t)
+	for range n {
+		fr.clock.Advance(100 * time.Millisecond)
+		fr.runPending(t)
+	}
+}
+
+func (fr *frameRoom) frame(t *testing.T, frame uint64) map[int64]string {
+	t.Helper()
+	frames, err := fr.r.GetFrames(frame, frame)
+	if err != nil || len(frames) != 1 {
+		t.Fatalf("get frame %d: %v, %d frames", frame, err, len(frames))
+	}
+	inputs := make(map[int64]string)
+	for _, input := range frames[0].Inputs {
+		inputs[input.UID] = string(input.Data)
+	}
+	return inputs
+}
+
+// 非玩家的输入被拒绝，同一帧重复提交以最后一次为准，没有输入的玩家补空输入
+func TestFrameSyncInput(t *testing.T) {
+	fr := newFrameRoom(t)
+	if err := fr.r.SubmitInput(3, 1, []byte("x")); !errors.Is(err, room.ErrNotPlayer) {
+		t.Fatalf("submit from non-player: got %v, want ErrNotPlayer", err)
+	}
+	fr.r.SubmitInput(1, 1, []byte("a"))
+	fr.r.SubmitInput(1, 1, []byte("b"))
+	fr.r.SubmitInput(2, 2, []byte("c"))
+	fr.tick(t, 2)
+
+	if inputs := fr.frame(t, 1); len(inputs) != 2 || inputs[1] != "b" || inputs[2] != "" {
+		t.Fatalf("frame 1 inputs %v, want 1=b and empty 2", inputs)
+	}
+	if inputs := fr.frame(t, 2); len(inputs) != 2 || inputs[1] != "" || inputs[2] != "c" {
+		t.Fatalf("frame 2 inputs %v, want empty 1 and 2=c", inputs)
+	}
+
+	// 每个连接按自己的 Codec 收到帧消息
+	for uid, sess := range fr.sessions {
+		if len(sess.sent) != 2 {
+			t.Fatalf("player %d received %d messages, want 2", uid, len(sess.sent))
+		}
+		env, err := sess.codec.Decode(sess.sent[0])
+		if err != nil {
+			t.Fatalf("player %d decode frame: %v", uid, err)
+		}
+		if env.Route != "frame" || env.RoomID != 1 || len(env.Payload) == 0 {
+			t.Fatalf("player %d received %+v, want frame event", uid, env)
+		}
+	}
+}
+
+// 迟到的输入顺延到下一帧，超过 64 帧之后的输入被丢弃
+func TestFrameSyncInputWindow(t *testing.T) {
+	fr := newFrameRoom(t)
+	fr.tick(t, 1)
+	fr.r.SubmitInput(1, 1, []byte("late"))
+	fr.r.SubmitInput(2, 66, []byte("ahead"))
+	fr.r.SubmitInput(1, 67, []byte("too far"))
+	fr.tick(t, 67)
+
+	if inputs := fr.frame(t, 2); inputs[1] != "late" {
+		t.Fatalf("frame 2 inputs %v, want late input", inputs)
+	}
+	if inputs := fr.frame(t, 66); inputs[2] != "ahead" {
+		t.Fatalf("frame 66 inputs %v, want input 64 frames ahead", inputs)
+	}
+	if inputs := fr.frame(t, 67); inputs[1] != "" {
+		t.Fatalf("frame 67 inputs %v, want input too far ahead dropped", inputs)
+	}
+}
+
+// 超过 WithFrameHistory 的历史帧被丢弃，GetFrames 返回的拷贝不受之后丢弃的影响
+func TestFrameSyncHistory(t *testing.T) {
+	fr := newFrameRoom(t, room.WithFrameHistory(5))
+	// 6 帧之后历史帧的底层数组还有空余，下一帧丢弃时原地清空
+	fr.tick(t, 6)
+
+	frames, err := fr.r.GetFrames(0, 0)
+	if err != nil {
+		t.Fatalf("get frames: %v", err)
+	}
+	if len(frames) != 5 || frames[0].Frame != 2 || frames[4].Frame != 6 {
+		t.Fatalf("got %d frames from %d, want frames 2-6", len(frames), frames[0].Frame)
+	}
+	if _, err := fr.r.GetFrames(1, 0); !errors.Is(err, room.ErrFramesDiscarded) {
+		t.Fatalf("get discarded frames: got %v, want ErrFramesDiscarded", err)
+	}
+
+	fr.tick(t, 1)
+	for i, f := range frames {
+		if f == nil || f.Frame != uint64(i+2) {
+			t.Fatalf("returned frame %d changed to %+v", i, f)
+		}
+	}
+	if frames, err := fr.r.GetFrames(0, 0); err != nil || frames[0].Frame != 3 {
+		t.Fatalf("get frames after trim: %v", err)
+	}
+}
@@ -12,20 +12,38 @@ type GameRoom interface {
 	UserEnterRoom(uid int64, roomID int64, sess session.Session)
 	// 用户离开房间
 	UserLeaveRoom(uid int64, roomID int64)
+	// 用户连接断开，玩家进入重连保留期
+	UserDisconnect(uid int64, sess session.Session)
+	// 观战者进入房间，不计入玩家人数
+	SpectatorEnter(uid int64, sess session.Session) error
+	// 观战者离开房间
+	SpectatorLeave(uid int64)
 	// 获取匹配信息
 	GetMatchInfo() *match.MatchInfo
 	// 检查房间
 	Check() bool
-	// 开始游戏
-	Start()
-	// 结束游戏
-	Close()
+	// 开始游戏，当前状态不允许开始时返回错误
+	Start() error
+	// 当前状态
+	GetStatus() int32
+	// 结束游戏，任何状态都可以关闭
+	Close(reason CloseReason)
+	// 暂停游戏
+	Pause() error
+	// 恢复暂停的游戏
+	Resume() error
 	// 广播消息
-	Broadcast(channelID string, msg []byte)
+	Broadcast(channelID ChannelID, msg []byte)
+	// 广播消息，跳过 except 中的用户
+	BroadcastExcept(channelID ChannelID, msg []byte, except ...int64)
+	// 广播给阵营内的玩家
+	BroadcastToCamp(camp int32, msg []byte)
+	// 发送给房间内的某个用户
+	SendTo(uid int64, msg []byte)
 	// 加入频道
-	JoinChannel(channelID string, uid int64, sess session.Session)
+	JoinChannel(channelID ChannelID, uid int64, sess session.Session)
 	// 离开频道
-	LeaveChannel(channelID string, uid int64)
+	LeaveChannel(channelID ChannelID, uid int64)
 	// 剔除用户（关闭Session）
 	KickUser(uid int64)
 }
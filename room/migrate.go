@@ -0,0 +1,120 @@
+package room
+
+import (
+	"errors"
+	"game_actor/session"
+	"game_actor/snapshot"
+	"log"
+)
+
+var (
+	ErrRoomFrozen    = errors.New("room frozen for migration")
+	ErrRoomNotFrozen = errors.New("room not frozen")
+)
+
+// Freeze 迁移房间的第一步：在 actor 中生成快照后阻塞 actor
+// 冻结期间投递的消息留在 mailbox 中，逻辑帧和定时器也不会执行，直到 Thaw 或 Detach
+// 冻结期间调用 SyncInvoke 的 goroutine 会一直等待，迁移需要设置超时并在失败时 Thaw
+// 会等待 actor 生成快照，不能在房间 actor 中调用
+func (r *RoomActor) Freeze() (*snapshot.Snapshot, error) {
+	release := make(chan func(), 1)
+	if !r.release.CompareAndSwap(nil, &release) {
+		return nil, ErrRoomFrozen
+	}
+
+	type result struct {
+		snap *snapshot.Snapshot
+		err  error
+	}
+	done := make(chan result, 1)
+	err := r.Invoke(func() {
+		if r.Status.Load() == RoomStatus_Close {
+			done <- result{err: ErrRoomClosed}
+			return
+		}
+		snap, err := r.buildSnapshot()
+		done <- result{snap, err}
+		if err != nil {
+			return
+		}
+		f := <-release
+		f()
+	})
+	if err != nil {
+		r.release.Store(nil)
+		return nil, err
+	}
+	var res result
+	select {
+	case res = <-done:
+	case <-r.actor.Stopped():
+		// actor 在执行到冻结任务之前停止了
+		select {
+		case res = <-done:
+		default:
+			res.err = ErrActorStopped
+		}
+	}
+	if res.err != nil {
+		r.release.Store(nil)
+		return nil, res.err
+	}
+	return res.snap, nil
+}
+
+// Thaw 迁移失败，房间继续运行，冻结期间投递的消息按顺序执行
+func (r *RoomActor) Thaw() error {
+	release := r.release.Swap(nil)
+	if release == nil {
+		return ErrRoomNotFrozen
+	}
+	*release <- func() {}
+	return nil
+}
+
+// NotifyFunc 生成发给用户的通知，sess 为用户当前的连接，可以按连接的 Codec 编码；返回 nil 表示不通知该用户
+type NotifyFunc func(uid int64, sess session.Session) []byte
+
+// Detach 迁移成功，房间已经在目标节点恢复
+// notify 返回发给每个用户（玩家和观战者）的迁移通知，之后停止 actor，冻结期间投递的消息被丢弃
+// 不会切换到关闭状态，不调用 OnClose，也不提交结算；本节点保存的快照被删除
+func (r *RoomActor) Detach(notify NotifyFunc) error {
+	release := r.release.Swap(nil)
+	if release == nil {
+		return ErrRoomNotFrozen
+	}
+	done := make(chan struct{})
+	*release <- func() {
+		defer close(done)
+		r.notifyUsers(notify)
+		r.stopEmptyTimer()
+		r.dropSnapshot()
+		r.actor.Abandon()
+	}
+	<-done
+	return nil
+}
+
+// notifyUsers 每个用户只通知一次，断线保留期内的玩家没有连接，不通知
+func (r *BaseRoom) notifyUsers(notify NotifyFunc) {
+	send := func(uid int64, sess session.Session) {
+		msg := notify(uid, sess)
+		if msg == nil {
+			return
+		}
+		if err := sess.Send(msg); err != nil {
+			log.Printf("Room %d notify %d error: %v", r.RoomID, uid, err)
+		}
+	}
+	r.defaultChannel().sessions.Range(func(key, value any) bool {
+		uid := key.(int64)
+		if _, offline := r.offline.Load(uid); !offline {
+			send(uid, value.(session.Session))
+		}
+		return true
+	})
+	r.spectators.Range(func(key, value any) bool {
+		send(key.(int64), value.(session.Session))
+		return true
+	})
+}
@@ -1,8 +1,19 @@
 package room
 
+import (
+	"game_actor/clock"
+	"game_actor/settle"
+	"game_actor/snapshot"
+	"time"
+)
+
 type RoomOption interface {
 	OnStart(roomID int64)
 	OnClose(roomID int64)
+	// 玩家断线，进入重连保留期，座位和阵营保留
+	OnDisconnect(roomID int64, uid int64)
+	// 玩家在保留期内使用新的 session 重新进入
+	OnReconnect(roomID int64, uid int64)
 }
 
 type PlayerOption interface {
@@ -10,9 +21,60 @@ type PlayerOption interface {
 	OnLeave(uid int64, isPlayer bool)
 }
 
+// TickOption 逻辑帧回调，在 actor 的 goroutine 中执行，不会与 mailbox 消息并发
+type TickOption interface {
+	// dt 为距上一帧的实际间隔，frame 从 1 开始递增
+	OnTick(dt time.Duration, frame uint64)
+}
+
+// PanicOption 房间内的任务或逻辑帧发生 panic 时通知游戏逻辑，在 actor 的 goroutine 中执行
+type PanicOption interface {
+	// recovered 为 recover() 的返回值，policy 为接下来要执行的监管策略
+	OnPanic(roomID int64, recovered any, stack []byte, policy SupervisorPolicy)
+}
+
 type Option struct {
 	roomOpts   []RoomOption
 	playerOpts []PlayerOption
+	tickOpts   []TickOption
+	panicOpts  []PanicOption
+	stateOpts  []StateOption
+	// 观战者进入/离开通知
+	spectatorOpts []SpectatorOption
+	// 每秒逻辑帧数，0 表示不开启 tick
+	tickRate int
+	// 断线重连保留时间，0 表示使用 MatchInfo.ReconnectGraceTime
+	reconnectGrace time.Duration
+	// mailbox 容量，0 表示无界
+	mailboxSize    int
+	overflow       OverflowPolicy
+	mailboxTimeout time.Duration
+	// panic 后的监管策略，默认跳过出错的任务
+	supervisor SupervisorPolicy
+	restart    RestartFunc
+	// 房间定时器使用的时钟，默认为系统时钟
+	clock clock.Clock
+	// 为空时使用 DefaultStateMachine
+	stateMachine *StateMachine
+	// 投票暂停需要的玩家比例，0 表示不允许投票暂停
+	pauseVoteRatio float64
+	// 观战人数上限，0 表示不限制
+	maxSpectators int
+	// 观战延迟，0 表示不延迟
+	spectatorDelay time.Duration
+	// 对局结算管道，为空时不提交结果
+	settler *settle.Settler
+	// 自动关闭规则
+	autoClose AutoClose
+	// 录制房间的输入输出，用于回放
+	recorder Recorder
+	// 快照存储和定时快照的间隔，interval 为 0 时只在 TakeSnapshot 时保存
+	snapshotStore    snapshot.Store
+	snapshotInterval time.Duration
+	// 游戏自定义状态的快照
+	snapshotter Snapshotter
+	// FrameSyncRoom 保留的历史帧数，0 表示使用 defaultFrameHistory
+	frameHistory int
 }
 
 type OptionFunc func(*Option)
@@ -28,3 +90,132 @@ func WithPlayerOption(opt PlayerOption) OptionFunc {
 		o.playerOpts = append(o.playerOpts, opt)
 	}
 }
+
+// WithTickRate 设置房间逻辑帧率（如 20/30/60 Hz）
+func WithTickRate(hz int) OptionFunc {
+	return func(o *Option) {
+		o.tickRate = hz
+	}
+}
+
+func WithTickOption(opt TickOption) OptionFunc {
+	return func(o *Option) {
+		o.tickOpts = append(o.tickOpts, opt)
+	}
+}
+
+// WithReconnectGrace 设置断线重连保留时间，优先于 MatchInfo.ReconnectGraceTime
+func WithReconnectGrace(d time.Duration) OptionFunc {
+	return func(o *Option) {
+		o.reconnectGrace = d
+	}
+}
+
+// WithMailbox 使用有界 mailbox，队列满时按 policy 处理
+// timeout 只对 OverflowBlock 生效，0 表示一直等待
+// 容量只限制从外部异步投递的任务；SyncInvoke（Start/Close 等）和房间 actor 内部通过 InvokeCtx(Actor().Context()) 投递的任务不会被丢弃、拒绝或阻塞
+func WithMailbox(size int, policy OverflowPolicy, timeout time.Duration) OptionFunc {
+	return func(o *Option) {
+		o.mailboxSize = size
+		o.overflow = policy
+		o.mailboxTimeout = timeout
+	}
+}
+
+func WithPanicOption(opt PanicOption) OptionFunc {
+	return func(o *Option) {
+		o.panicOpts = append(o.panicOpts, opt)
+	}
+}
+
+// WithSupervisor 设置 panic 后的监管策略，restart 只在 SuperviseRestart 时使用
+func WithSupervisor(policy SupervisorPolicy, restart RestartFunc) OptionFunc {
+	return func(o *Option) {
+		o.supervisor = policy
+		o.restart = restart
+	}
+}
+
+// WithClock 设置房间定时器（AfterFunc/Every、重连保留期）使用的时钟，测试中可以使用 clock.Fake
+func WithClock(c clock.Clock) OptionFunc {
+	return func(o *Option) {
+		o.clock = c
+	}
+}
+
+// WithStateMachine 使用自定义的状态机
+func WithStateMachine(m *StateMachine) OptionFunc {
+	return func(o *Option) {
+		o.stateMachine = m
+	}
+}
+
+func WithStateOption(opt StateOption) OptionFunc {
+	return func(o *Option) {
+		o.stateOpts = append(o.stateOpts, opt)
+	}
+}
+
+// WithPauseVote 允许玩家投票暂停，ratio 为需要的玩家比例（如 0.5 表示半数玩家同意）
+func WithPauseVote(ratio float64) OptionFunc {
+	return func(o *Option) {
+		o.pauseVoteRatio = ratio
+	}
+}
+
+// WithSpectators 设置观战人数上限和观战延迟，观战者收到的默认频道消息比玩家晚 delay
+func WithSpectators(limit int, delay time.Duration) OptionFunc {
+	return func(o *Option) {
+		o.maxSpectators = limit
+		o.spectatorDelay = delay
+	}
+}
+
+func WithSpectatorOption(opt SpectatorOption) OptionFunc {
+	return func(o *Option) {
+		o.spectatorOpts = append(o.spectatorOpts, opt)
+	}
+}
+
+// WithSettler 房间关闭时把对局结果提交到结算管道，多个房间共用一个 Settler
+func WithSettler(s *settle.Settler) OptionFunc {
+	return func(o *Option) {
+		o.settler = s
+	}
+}
+
+// WithAutoClose 设置自动关闭规则
+func WithAutoClose(rule AutoClose) OptionFunc {
+	return func(o *Option) {
+		o.autoClose = rule
+	}
+}
+
+// WithRecorder 录制房间的客户端消息、对外调用、发出的消息和状态切换，见 replay 包
+func WithRecorder(rec Recorder) OptionFunc {
+	return func(o *Option) {
+		o.recorder = rec
+	}
+}
+
+// WithSnapshot 定时在 actor 中生成快照并保存到 store，房间关闭后删除快照，见 RoomService.RestoreRooms
+func WithSnapshot(store snapshot.Store, interval time.Duration) OptionFunc {
+	return func(o *Option) {
+		o.snapshotStore = store
+		o.snapshotInterval = interval
+	}
+}
+
+// WithSnapshotter 快照中包含游戏自定义的状态
+func WithSnapshotter(s Snapshotter) OptionFunc {
+	return func(o *Option) {
+		o.snapshotter = s
+	}
+}
+
+// WithFrameHistory 设置 FrameSyncRoom 保留的历史帧数，更早的帧丢弃后不能再补帧，快照中也不包含
+func WithFrameHistory(frames int) OptionFunc {
+	return func(o *Option) {
+		o.frameHistory = frames
+	}
+}
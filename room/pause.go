@@ -0,0 +1,121 @@
+package room
+
+import (
+	"errors"
+	"game_actor/codec"
+	"game_actor/session"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var (
+	ErrRoomNotRunning    = errors.New("room not running")
+	ErrRoomNotPaused     = errors.New("room not paused")
+	ErrPauseVoteDisabled = errors.New("pause vote disabled")
+	ErrNotPlayer         = errors.New("not a player of this room")
+)
+
+// pauseEvent 暂停/恢复时广播给房间的所有频道，route 为 pause 或 resume
+// 按连接的 Codec 编码，protobuf 格式见 envelope.proto 中的 PauseEvent
+type pauseEvent struct {
+	// 房间累计暂停的时长（毫秒），包括正在进行的暂停
+	PausedMs int64 `json:"paused_ms"`
+}
+
+func (e *pauseEvent) MarshalWire() []byte {
+	var b []byte
+	if e.PausedMs != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(e.PausedMs))
+	}
+	return b
+}
+
+// Pause 暂停运行中的房间，逻辑帧和定时器停止，直到 Resume
+func (r *BaseRoom) Pause() error {
+	if r.Status.Load() != RoomStatus_Start {
+		return ErrRoomNotRunning
+	}
+	return r.Transition(RoomStatus_Paused)
+}
+
+// Resume 恢复暂停的房间
+func (r *BaseRoom) Resume() error {
+	if r.Status.Load() != RoomStatus_Paused {
+		return ErrRoomNotPaused
+	}
+	return r.Transition(RoomStatus_Start)
+}
+
+// VotePause 玩家投票暂停，返回是否达到 WithPauseVote 设置的票数，达到后由调用方执行暂停
+func (r *BaseRoom) VotePause(uid int64) (bool, error) {
+	ratio := r.option.pauseVoteRatio
+	if ratio <= 0 {
+		return false, ErrPauseVoteDisabled
+	}
+	if !r.isPlayer(uid) {
+		return false, ErrNotPlayer
+	}
+	if r.Status.Load() != RoomStatus_Start {
+		return false, ErrRoomNotRunning
+	}
+	if r.pauseVotes == nil {
+		r.pauseVotes = make(map[int64]bool)
+	}
+	r.pauseVotes[uid] = true
+	required := max(int(math.Ceil(ratio*float64(len(r.matchInfo.Players)))), 1)
+	return len(r.pauseVotes) >= required, nil
+}
+
+// onPauseChange 进入或离开暂停状态时暂停/恢复定时器、清空投票并通知客户端
+func (r *BaseRoom) onPauseChange(from, to int32) {
+	var action string
+	switch {
+	case to == RoomStatus_Paused:
+		action = "pause"
+		r.pausedAt = r.now()
+		if r.timers != nil {
+			r.timers.PauseTimers()
+		}
+	case from == RoomStatus_Paused:
+		action = "resume"
+		r.pausedTotal += r.now().Sub(r.pausedAt)
+		r.pausedAt = time.Time{}
+		if r.timers != nil {
+			r.timers.ResumeTimers()
+		}
+	default:
+		return
+	}
+	r.pauseVotes = nil
+
+	paused := r.pausedDuration(r.now())
+	r.broadcastAll(newEvent(r.RoomID, action, &pauseEvent{PausedMs: paused.Milliseconds()}))
+}
+
+// pausedDuration 到 now 为止累计暂停的时长
+func (r *BaseRoom) pausedDuration(now time.Time) time.Duration {
+	if r.pausedAt.IsZero() {
+		return r.pausedTotal
+	}
+	return r.pausedTotal + now.Sub(r.pausedAt)
+}
+
+// broadcastAll 按 session 的 Codec 编码后发送给房间所有频道中的 session，同一个 session 只发送一次
+func (r *BaseRoom) broadcastAll(e *event) {
+	r.record(RecordOutbound, 0, "*", 0, e.encode(codec.JSON))
+	sent := make(map[session.Session]bool)
+	r.channels.Range(func(key, value any) bool {
+		value.(*Channel).sessions.Range(func(key, value any) bool {
+			sess := value.(session.Session)
+			if !sent[sess] {
+				sent[sess] = true
+				e.sendTo(sess)
+			}
+			return true
+		})
+		return true
+	})
+}
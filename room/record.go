@@ -0,0 +1,77 @@
+package room
+
+import "time"
+
+// RecordKind 录制事件的类型
+type RecordKind uint8
+
+const (
+	// 房间创建，录制的第一个事件，回放从这个时间开始
+	RecordCreate RecordKind = iota + 1
+	// 客户端消息：UID、Name 为 route、Code 为消息 ID、Data 为 payload
+	RecordInbound
+	// 外部调用房间的方法：Name 为 Command* 常量
+	RecordCommand
+	// Broadcast/SendTo 发出的消息：Name 为频道（广播给所有频道时为 "*"）、SendTo 时 UID 为接收者
+	RecordOutbound
+	// 状态切换：Name 为新状态名、Code 为新状态
+	RecordState
+)
+
+// IsOutput 是否为房间的输出，回放时只比较输出
+func (k RecordKind) IsOutput() bool {
+	return k == RecordOutbound || k == RecordState
+}
+
+// RecordCommand 的 Name，UID 为操作的用户
+const (
+	CommandEnter          = "enter" // Code 为 1 表示带 session
+	CommandLeave          = "leave"
+	CommandDisconnect     = "disconnect"
+	CommandKick           = "kick"
+	CommandSpectate       = "spectate"
+	CommandSpectatorLeave = "spectator_leave"
+	CommandJoinChannel    = "join_channel"  // Data 为频道
+	CommandLeaveChannel   = "leave_channel" // Data 为频道
+	CommandStart          = "start"
+	CommandTransition     = "transition" // Code 为目标状态
+	CommandPause          = "pause"
+	CommandResume         = "resume"
+	CommandVotePause      = "vote_pause"
+	CommandClose          = "close" // Code 为 CloseReason
+)
+
+// RecordEvent 录制的事件，At 为房间时钟的时间
+type RecordEvent struct {
+	At   time.Time
+	Kind RecordKind
+	UID  int64
+	Name string
+	Code uint32
+	Data []byte
+}
+
+// Recorder 录制房间的输入、输出和生命周期事件，在 actor goroutine 中调用
+// 文件格式和回放见 replay 包
+type Recorder interface {
+	Record(e *RecordEvent)
+}
+
+// RecordInbound 录制客户端消息，由 router 在房间 actor 中执行 handler 前调用
+func (r *BaseRoom) RecordInbound(uid int64, route string, msgID uint32, payload []byte) {
+	r.record(RecordInbound, uid, route, msgID, payload)
+}
+
+func (r *BaseRoom) record(kind RecordKind, uid int64, name string, code uint32, data []byte) {
+	if r.option.recorder == nil {
+		return
+	}
+	r.option.recorder.Record(&RecordEvent{
+		At:   r.now(),
+		Kind: kind,
+		UID:  uid,
+		Name: name,
+		Code: code,
+		Data: data,
+	})
+}
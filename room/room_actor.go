@@ -1,114 +1,339 @@
 package room
 
 import (
+	"context"
+	"game_actor/actor"
 	"game_actor/match"
 	"game_actor/session"
+	"game_actor/settle"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// ActorKind 房间 actor 在 actor.Registry 中的 kind
+const ActorKind = "room"
+
+// mailbox 相关的类型和错误由 actor 包提供，这里保留别名方便游戏逻辑使用
+type (
+	OverflowPolicy = actor.OverflowPolicy
+	MailboxStats   = actor.MailboxStats
+	// Timer AfterFunc/Every 返回的句柄，可以在任意 goroutine 中 Stop
+	Timer = actor.Timer
+)
+
+const (
+	OverflowBlock      = actor.OverflowBlock
+	OverflowDropNewest = actor.OverflowDropNewest
+	OverflowDropOldest = actor.OverflowDropOldest
+	OverflowReject     = actor.OverflowReject
+)
 
-	"github.com/vladopajic/go-actor/actor"
+var (
+	// ErrActorStopped 房间 actor 已经停止，投递的任务不会再被执行
+	ErrActorStopped   = actor.ErrStopped
+	ErrMailboxFull    = actor.ErrMailboxFull
+	ErrMailboxTimeout = actor.ErrMailboxTimeout
 )
 
+// RoomActor 消息为闭包的 actor，房间的所有状态只在 actor goroutine 中访问
 type RoomActor struct {
 	*BaseRoom
-	actor   actor.Actor
-	mailbox actor.MailboxSender[func()]
+	actor *actor.Actor[func()]
+	// 逻辑帧，未开启 tick 时为空
+	ticker *roomTicker
+	// 冻结中时不为空，Thaw/Detach 通过它释放 actor，见 Freeze
+	release atomic.Pointer[chan func()]
+	// 房间自己发起关闭时通过它关闭房间，一般由 RoomService 设置为 CloseRoom
+	closeHandler atomic.Pointer[func(roomID int64, reason CloseReason)]
 }
 
-type roomWorker struct {
-	mailbox actor.MailboxReceiver[func()]
+// roomTicker 把逻辑帧接入 actor 的事件源
+type roomTicker struct {
+	room *BaseRoom
+	loop *tickLoop
 }
 
-func (w *roomWorker) DoWork(ctx actor.Context) actor.WorkerStatus {
-	select {
-	case <-ctx.Done():
-		return actor.WorkerEnd
-	case fn := <-w.mailbox.ReceiveC():
-		fn()
-		return actor.WorkerContinue
+func (t *roomTicker) C() <-chan time.Time {
+	return t.loop.C()
+}
+
+func (t *roomTicker) Fire(now time.Time) {
+	// 游戏未开始时只维持节拍，帧号从游戏开始后计算
+	if t.room.Status.Load() != RoomStatus_Start {
+		t.loop.idle(now)
+		return
 	}
+	dt, frame := t.loop.advance(now)
+	t.room.tick(dt, frame)
+}
+
+func (t *roomTicker) Stop() {
+	t.loop.stop()
+}
+
+// runFunc 房间 actor 的 Behavior，直接执行投递的闭包
+func runFunc(f func()) (any, error) {
+	f()
+	return nil, nil
 }
 
 func NewRoomActor(roomID int64, matchInfo *match.MatchInfo, opts ...OptionFunc) *RoomActor {
-	mbx := actor.NewMailbox[func()]()
-	worker := &roomWorker{mailbox: mbx}
-	a := actor.New(worker)
-	a.Start()
-
-	return &RoomActor{
-		BaseRoom: NewBaseRoom(roomID, matchInfo, opts...),
-		actor:    a,
-		mailbox:  mbx,
+	baseRoom := NewBaseRoom(roomID, matchInfo, opts...)
+	r := &RoomActor{
+		BaseRoom: baseRoom,
+	}
+	option := baseRoom.option
+	actorOpts := []actor.OptionFunc{
+		actor.WithMailbox(option.mailboxSize, option.overflow, option.mailboxTimeout),
+		actor.WithPanicHandler(r.handlePanic),
+	}
+	if option.clock != nil {
+		actorOpts = append(actorOpts, actor.WithClock(option.clock))
+	}
+	if loop := newTickLoop(option.tickRate, baseRoom.clock()); loop != nil {
+		r.ticker = &roomTicker{room: baseRoom, loop: loop}
+		actorOpts = append(actorOpts, actor.WithSource(r.ticker))
+	}
+	baseRoom.record(RecordCreate, 0, "", 0, nil)
+	r.actor = actor.New[func()](ActorKind, roomID, actor.BehaviorFunc[func()](runFunc), actorOpts...)
+	baseRoom.timers = r.actor
+	baseRoom.closer = r.CloseAsync
+	baseRoom.invoker = r.Invoke
+	if option.snapshotStore != nil {
+		baseRoom.snapshots = &snapshotSaver{store: option.snapshotStore}
+		if option.snapshotInterval > 0 {
+			r.actor.Every(option.snapshotInterval, r.snapshotPeriodic)
+		}
 	}
+	// actor 停止后不会再有录制事件，关闭录制文件
+	if c, ok := option.recorder.(io.Closer); ok {
+		go func() {
+			<-r.actor.Stopped()
+			c.Close()
+		}()
+	}
+	return r
+}
+
+// Base 底层的 BaseRoom，方法不经过 mailbox，只能在 actor goroutine 中调用（如房间级 handler 中）
+func (r *RoomActor) Base() *BaseRoom {
+	return r.BaseRoom
+}
+
+// Actor 底层的通用 actor，可以注册到 actor.Registry
+func (r *RoomActor) Actor() *actor.Actor[func()] {
+	return r.actor
 }
 
 // Invoke 异步投递任务，不等待结果
+// 使用有界 mailbox 时，队列满的处理方式见 WithMailbox
 func (r *RoomActor) Invoke(f func()) error {
-	return r.mailbox.Send(nil, f)
+	return r.actor.Tell(f)
+}
+
+// InvokeCtx 同 Invoke，在房间 actor 中投递时传入 Actor().Context()，不受有界 mailbox 的容量限制
+func (r *RoomActor) InvokeCtx(ctx context.Context, f func()) error {
+	return r.actor.InvokeCtx(ctx, f)
 }
 
 // SyncInvoke 同步投递任务，等待执行结果
 func (r *RoomActor) SyncInvoke(f func() (any, error)) (any, error) {
-	resultChan := make(chan any, 1)
-	errChan := make(chan error, 1)
-	err := r.mailbox.Send(nil, func() {
-		res, fnErr := f()
-		resultChan <- res
-		errChan <- fnErr
-	})
-	if err != nil {
-		return nil, err
-	}
-	return <-resultChan, <-errChan
+	return r.SyncInvokeCtx(context.Background(), f)
+}
+
+// SyncInvokeCtx 同步投递任务，等待执行结果或 ctx 结束
+// 在房间 actor 中调用时传入 Actor().Context()，直接执行 f，避免等待自己造成死锁
+// actor 已经停止时返回 ErrActorStopped；ctx 结束时返回 ctx.Err()，此时 f 仍可能稍后执行
+func (r *RoomActor) SyncInvokeCtx(ctx context.Context, f func() (any, error)) (any, error) {
+	return r.actor.SyncInvokeCtx(ctx, f)
+}
+
+// AfterFunc d 之后在房间 actor 中执行 f，房间关闭时自动取消
+// 如 "30 秒后结束本回合"，不需要自己启动 goroutine 再通过 Invoke 回到房间
+func (r *RoomActor) AfterFunc(d time.Duration, f func()) *Timer {
+	return r.actor.AfterFunc(d, f)
+}
+
+// Every 每隔 d 在房间 actor 中执行一次 f，直到 Timer.Stop 或房间关闭
+func (r *RoomActor) Every(d time.Duration, f func()) *Timer {
+	return r.actor.Every(d, f)
+}
+
+// MailboxStats 获取 mailbox 的排队、丢弃统计
+func (r *RoomActor) MailboxStats() MailboxStats {
+	return r.actor.MailboxStats()
 }
 
 func (r *RoomActor) UserEnterRoom(uid int64, roomID int64, sess session.Session) {
 	r.Invoke(func() {
+		var withSession uint32
+		if sess != nil {
+			withSession = 1
+		}
+		r.record(RecordCommand, uid, CommandEnter, withSession, nil)
 		r.BaseRoom.UserEnterRoom(uid, roomID, sess)
 	})
 }
 
 func (r *RoomActor) UserLeaveRoom(uid int64, roomID int64) {
 	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandLeave, 0, nil)
 		r.BaseRoom.UserLeaveRoom(uid, roomID)
 	})
 }
 
+func (r *RoomActor) UserDisconnect(uid int64, sess session.Session) {
+	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandDisconnect, 0, nil)
+		grace := r.BaseRoom.UserDisconnect(uid, sess)
+		if grace <= 0 {
+			return
+		}
+		// 保留期结束后在 actor 中检查是否已经重连
+		r.AfterFunc(grace, func() {
+			r.BaseRoom.expireDisconnect(uid, sess)
+		})
+	})
+}
+
+// SpectatorEnter 以观战者身份进入房间，超过观战人数上限时返回 ErrSpectatorFull
+func (r *RoomActor) SpectatorEnter(uid int64, sess session.Session) error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, uid, CommandSpectate, 0, nil)
+		return nil, r.BaseRoom.SpectatorEnter(uid, sess)
+	})
+	return err
+}
+
+func (r *RoomActor) SpectatorLeave(uid int64) {
+	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandSpectatorLeave, 0, nil)
+		r.BaseRoom.SpectatorLeave(uid)
+	})
+}
+
+// SetResult 设置对局结果，房间关闭时提交
+func (r *RoomActor) SetResult(res *settle.Result) {
+	r.Invoke(func() {
+		r.BaseRoom.SetResult(res)
+	})
+}
+
+// Settle 立即提交对局结果
+func (r *RoomActor) Settle(res *settle.Result) error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		return nil, r.BaseRoom.Settle(res)
+	})
+	return err
+}
+
 func (r *RoomActor) KickUser(uid int64) {
 	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandKick, 0, nil)
 		r.BaseRoom.KickUser(uid)
 	})
 }
 
-func (r *RoomActor) Start() {
-	r.Invoke(func() {
-		r.BaseRoom.Start()
+func (r *RoomActor) Start() error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, 0, CommandStart, 0, nil)
+		return nil, r.BaseRoom.Start()
 	})
+	return err
 }
 
-func (r *RoomActor) Close() {
-	// 使用 SyncInvoke 等待关闭逻辑完成
+// Transition 在 actor 中切换房间状态
+func (r *RoomActor) Transition(to int32) error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, 0, CommandTransition, uint32(to), nil)
+		return nil, r.BaseRoom.Transition(to)
+	})
+	return err
+}
+
+// Close 关闭房间，等待关闭逻辑执行完、actor 退出
+// 不能在房间 actor 中调用（消息处理、定时器、逻辑帧中会等待自己），actor 内部使用 CloseAsync
+func (r *RoomActor) Close(reason CloseReason) {
 	r.SyncInvoke(func() (any, error) {
-		r.BaseRoom.Close()
+		r.record(RecordCommand, 0, CommandClose, uint32(reason), nil)
+		r.BaseRoom.Close(reason)
 		return nil, nil
 	})
 
-	// 停止 actor
 	r.actor.Stop()
 }
 
-func (r *RoomActor) Broadcast(channelID string, msg []byte) {
+// Pause 暂停房间，逻辑帧和 AfterFunc/Every 定时器停止，并通知房间内的客户端
+func (r *RoomActor) Pause() error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, 0, CommandPause, 0, nil)
+		return nil, r.BaseRoom.Pause()
+	})
+	return err
+}
+
+// Resume 恢复房间，定时器的剩余时间和暂停前一致
+func (r *RoomActor) Resume() error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, 0, CommandResume, 0, nil)
+		return nil, r.BaseRoom.Resume()
+	})
+	return err
+}
+
+// VotePause 玩家投票暂停，返回是否达到票数
+func (r *RoomActor) VotePause(uid int64) (bool, error) {
+	res, err := r.SyncInvoke(func() (any, error) {
+		r.record(RecordCommand, uid, CommandVotePause, 0, nil)
+		return r.BaseRoom.VotePause(uid)
+	})
+	if err != nil {
+		return false, err
+	}
+	return res.(bool), nil
+}
+
+func (r *RoomActor) Broadcast(channelID ChannelID, msg []byte) {
 	r.Invoke(func() {
 		r.BaseRoom.Broadcast(channelID, msg)
 	})
 }
 
-func (r *RoomActor) JoinChannel(channelID string, uid int64, sess session.Session) {
+func (r *RoomActor) BroadcastPayload(channelID ChannelID, uid int64, route string, payload []byte) {
+	r.Invoke(func() {
+		r.BaseRoom.BroadcastPayload(channelID, uid, route, payload)
+	})
+}
+
+func (r *RoomActor) BroadcastExcept(channelID ChannelID, msg []byte, except ...int64) {
+	r.Invoke(func() {
+		r.BaseRoom.BroadcastExcept(channelID, msg, except...)
+	})
+}
+
+func (r *RoomActor) BroadcastToCamp(camp int32, msg []byte) {
+	r.Invoke(func() {
+		r.BaseRoom.BroadcastToCamp(camp, msg)
+	})
+}
+
+func (r *RoomActor) SendTo(uid int64, msg []byte) {
+	r.Invoke(func() {
+		r.BaseRoom.SendTo(uid, msg)
+	})
+}
+
+func (r *RoomActor) JoinChannel(channelID ChannelID, uid int64, sess session.Session) {
 	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandJoinChannel, 0, []byte(channelID))
 		r.BaseRoom.JoinChannel(channelID, uid, sess)
 	})
 }
 
-func (r *RoomActor) LeaveChannel(channelID string, uid int64) {
+func (r *RoomActor) LeaveChannel(channelID ChannelID, uid int64) {
 	r.Invoke(func() {
+		r.record(RecordCommand, uid, CommandLeaveChannel, 0, []byte(channelID))
 		r.BaseRoom.LeaveChannel(channelID, uid)
 	})
 }
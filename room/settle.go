@@ -0,0 +1,99 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"game_actor/settle"
+	"log"
+	"time"
+)
+
+// BaseRoom 单独使用时同步提交结果的超时时间
+const settleTimeout = 3 * time.Second
+
+// SetResult 设置对局结果，房间关闭时提交给 WithSettler 设置的结算管道
+// MatchID、GameID、RoomID、EndAt 为空时自动填充，Reason 为空时使用关闭原因
+func (r *BaseRoom) SetResult(res *settle.Result) {
+	r.result = res
+}
+
+// Settle 立即提交对局结果，之后房间关闭时不会再次提交，已经提交过时返回 settle.ErrDuplicate
+// RoomActor 中通过 SubmitAsync 在后台提交，去重和写入 Outbox 不阻塞逻辑帧和消息处理；
+// 提交失败时记录日志，房间还在运行时游戏逻辑可以再次提交
+// BaseRoom 单独使用（没有 RoomActor）时同步提交并返回错误
+func (r *BaseRoom) Settle(res *settle.Result) error {
+	settler := r.option.settler
+	if settler == nil {
+		return nil
+	}
+	if r.settled {
+		return settle.ErrDuplicate
+	}
+	r.fillResult(res)
+	if r.invoker == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), settleTimeout)
+		defer cancel()
+		err := settler.Submit(ctx, res)
+		// 重复提交说明结果已经被接受过
+		if err == nil || errors.Is(err, settle.ErrDuplicate) {
+			r.settled = true
+		}
+		return err
+	}
+	err := settler.SubmitAsync(res, func(err error) {
+		if err == nil || errors.Is(err, settle.ErrDuplicate) {
+			return
+		}
+		log.Printf("Room %d settle match %d error: %v", r.RoomID, res.MatchID, err)
+		// 房间已经关闭时 actor 不再执行
+		r.invoker(func() { r.settled = false })
+	})
+	if err != nil {
+		return err
+	}
+	r.settled = true
+	return nil
+}
+
+// settleOnClose 房间关闭时提交结果，游戏逻辑没有设置结果时按关闭原因提交
+func (r *BaseRoom) settleOnClose() {
+	if r.settled || r.option.settler == nil {
+		return
+	}
+	res := r.result
+	if res == nil {
+		res = &settle.Result{Reason: r.closeReason.SettleReason()}
+	}
+	if err := r.Settle(res); err != nil {
+		log.Printf("Room %d settle error: %v", r.RoomID, err)
+	}
+}
+
+func (r *BaseRoom) fillResult(res *settle.Result) {
+	if r.matchInfo != nil {
+		if res.MatchID == 0 {
+			res.MatchID = r.matchInfo.MatchID
+		}
+		if res.GameID == 0 {
+			res.GameID = r.matchInfo.GameID
+		}
+		if res.Players == nil {
+			for _, player := range r.matchInfo.Players {
+				res.Players = append(res.Players, &settle.PlayerResult{
+					UID:     player.PlayerUID,
+					Camp:    player.Camp,
+					Outcome: settle.OutcomeNone,
+				})
+			}
+		}
+	}
+	if res.RoomID == 0 {
+		res.RoomID = r.RoomID
+	}
+	if res.Reason == "" {
+		res.Reason = r.closeReason.SettleReason()
+	}
+	if res.EndAt.IsZero() {
+		res.EndAt = r.now()
+	}
+}
@@ -0,0 +1,67 @@
+package room_test
+
+import (
+	"context"
+	"game_actor/match"
+	"game_actor/room"
+	"game_actor/settle"
+	"testing"
+	"time"
+)
+
+// blockingDeduper 模拟很慢的 Redis，release 之前 Add 一直阻塞
+type blockingDeduper struct {
+	release chan struct{}
+}
+
+func (d *blockingDeduper) Add(ctx context.Context, matchID int64) (bool, error) {
+	<-d.release
+	return true, nil
+}
+
+func (d *blockingDeduper) Remove(ctx context.Context, matchID int64) error { return nil }
+
+type resultSink chan *settle.Result
+
+func (s resultSink) Name() string { return "test" }
+
+func (s resultSink) Deliver(ctx context.Context, r *settle.Result) error {
+	s <- r
+	return nil
+}
+
+// 去重阻塞时房间的 Settle 和关闭不等待，结果在后台提交
+func TestSettleDoesNotBlockRoom(t *testing.T) {
+	dedupe := &blockingDeduper{release: make(chan struct{})}
+	sink := make(resultSink, 1)
+	settler := settle.New(settle.WithDeduper(dedupe), settle.WithSink(sink))
+	matchInfo := &match.MatchInfo{MatchID: 9, Players: []*match.Player{{PlayerUID: 1}}}
+	r := room.NewRoomActor(1, matchInfo, room.WithSettler(settler))
+
+	closed := make(chan struct{})
+	go func() {
+		r.SetResult(&settle.Result{Reason: settle.ReasonNormal})
+		r.Close(room.CloseNormal)
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("room close blocked on settle")
+	}
+
+	close(dedupe.release)
+	select {
+	case res := <-sink:
+		if res.MatchID != 9 || res.RoomID != 1 || res.Reason != settle.ReasonNormal {
+			t.Fatalf("settled %+v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("result not delivered")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := settler.Close(ctx); err != nil {
+		t.Fatalf("close settler: %v", err)
+	}
+}
@@ -0,0 +1,245 @@
+package room
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"game_actor/snapshot"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// 单次保存或删除快照的超时时间
+	snapshotTimeout = 5 * time.Second
+	// 没有设置重连保留期时，恢复的玩家重新连接的时间，超时后离开房间
+	restoreGrace = time.Minute
+)
+
+var (
+	ErrNoSnapshotStore  = errors.New("snapshot store not set")
+	ErrSnapshotMismatch = errors.New("snapshot belongs to another room")
+	ErrRoomNotFresh     = errors.New("room already in use, cannot restore")
+)
+
+// Snapshotter 游戏房实现后，快照中会包含游戏自定义的状态，通过 WithSnapshotter 设置
+// 两个方法都在 actor goroutine 中调用
+type Snapshotter interface {
+	Snapshot() ([]byte, error)
+	// Restore 在房间恢复时调用，早于玩家重新进入
+	Restore(data []byte) error
+}
+
+// snapshotSaver 在 actor 之外保存快照，旧的快照不会覆盖新的，房间关闭后不再保存
+type snapshotSaver struct {
+	mu     sync.Mutex
+	store  snapshot.Store
+	saved  uint64
+	closed bool
+}
+
+func (s *snapshotSaver) save(snap *snapshot.Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || snap.Seq <= s.saved {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	if err := s.store.Save(ctx, snap); err != nil {
+		return err
+	}
+	s.saved = snap.Seq
+	return nil
+}
+
+// drop 房间已经关闭，不需要再恢复
+func (s *snapshotSaver) drop(roomID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	ctx, cancel := context.WithTimeout(context.Background(), snapshotTimeout)
+	defer cancel()
+	return s.store.Delete(ctx, roomID)
+}
+
+// restoredSession 恢复的玩家在重新连接之前使用的占位 session
+// 玩家重新进入房间时按断线重连处理，占位 session 被替换
+type restoredSession struct {
+	uid int64
+}
+
+func (s *restoredSession) ID() string {
+	return fmt.Sprintf("restored-%d", s.uid)
+}
+
+func (s *restoredSession) UserID() int64 {
+	return s.uid
+}
+
+func (s *restoredSession) SetUserID(uid int64) {
+	s.uid = uid
+}
+
+func (s *restoredSession) Send(msg []byte) error {
+	return nil
+}
+
+func (s *restoredSession) Close() error {
+	return nil
+}
+
+// TakeSnapshot 在 actor 中生成快照，设置了 WithSnapshot 时同时保存到 store
+func (r *RoomActor) TakeSnapshot() (*snapshot.Snapshot, error) {
+	res, err := r.SyncInvoke(func() (any, error) {
+		return r.buildSnapshot()
+	})
+	if err != nil {
+		return nil, err
+	}
+	snap := res.(*snapshot.Snapshot)
+	if r.snapshots != nil {
+		if err := r.snapshots.save(snap); err != nil {
+			return snap, err
+		}
+	}
+	return snap, nil
+}
+
+// RestoreSnapshot 用快照恢复刚创建的房间，需要在玩家进入之前调用
+// 不会调用 OnStart 等回调；玩家处于断线状态，重新进入房间时按断线重连处理，保留期结束仍未重连的玩家离开房间
+func (r *RoomActor) RestoreSnapshot(snap *snapshot.Snapshot) error {
+	_, err := r.SyncInvoke(func() (any, error) {
+		return nil, r.restoreSnapshot(snap)
+	})
+	return err
+}
+
+// snapshotPeriodic 定时快照，保存不阻塞房间
+func (r *RoomActor) snapshotPeriodic() {
+	if r.Status.Load() == RoomStatus_Close {
+		return
+	}
+	snap, err := r.buildSnapshot()
+	if err != nil {
+		log.Printf("Room %d snapshot error: %v", r.RoomID, err)
+		return
+	}
+	go func() {
+		if err := r.snapshots.save(snap); err != nil {
+			log.Printf("Room %d save snapshot error: %v", r.RoomID, err)
+		}
+	}()
+}
+
+func (r *RoomActor) buildSnapshot() (*snapshot.Snapshot, error) {
+	now := r.now()
+	snap := &snapshot.Snapshot{
+		RoomID:    r.RoomID,
+		MatchInfo: r.matchInfo,
+		Status:    r.Status.Load(),
+		Result:    r.result,
+		Settled:   r.settled,
+		CreatedAt: r.createdAt,
+		StartedAt: r.startedAt,
+		Paused:    r.pausedDuration(now),
+		At:        now,
+	}
+	r.players.Range(func(key, value any) bool {
+		if uid := key.(int64); r.isPlayer(uid) {
+			snap.Players = append(snap.Players, uid)
+		}
+		return true
+	})
+	slices.Sort(snap.Players)
+	if r.ticker != nil {
+		snap.Frame = r.ticker.loop.frame
+	}
+	if s := r.option.snapshotter; s != nil {
+		data, err := s.Snapshot()
+		if err != nil {
+			return nil, err
+		}
+		snap.Data = data
+	}
+	r.snapshotSeq++
+	snap.Seq = r.snapshotSeq
+	return snap, nil
+}
+
+func (r *RoomActor) restoreSnapshot(snap *snapshot.Snapshot) error {
+	if snap.RoomID != r.RoomID {
+		return ErrSnapshotMismatch
+	}
+	if snap.Status == RoomStatus_Close {
+		return ErrRoomClosed
+	}
+	if r.Status.Load() != RoomStatus_Init || r.playerNum.Load() > 0 {
+		return ErrRoomNotFresh
+	}
+	// 先恢复游戏状态，失败时房间保持原样
+	if s := r.option.snapshotter; s != nil && snap.Data != nil {
+		if err := s.Restore(snap.Data); err != nil {
+			return err
+		}
+	}
+
+	r.result = snap.Result
+	r.settled = snap.Settled
+	r.createdAt = snap.CreatedAt
+	r.startedAt = snap.StartedAt
+	r.pausedTotal = snap.Paused
+	// 暂停中的房间从快照时起仍处于暂停，节点停机的时间也算作暂停
+	if snap.Status == RoomStatus_Paused {
+		r.pausedAt = snap.At
+	}
+	r.snapshotSeq = snap.Seq
+	if r.ticker != nil {
+		r.ticker.loop.frame = snap.Frame
+	}
+
+	// 恢复的玩家都需要重新连接，没有保留期时也要给一段时间，否则会一直占着座位
+	grace := r.reconnectGrace()
+	if grace <= 0 {
+		grace = restoreGrace
+	}
+	for _, uid := range snap.Players {
+		if !r.isPlayer(uid) {
+			continue
+		}
+		if _, loaded := r.players.LoadOrStore(uid, true); loaded {
+			continue
+		}
+		r.playerNum.Add(1)
+		sess := &restoredSession{uid: uid}
+		r.JoinChannel(RoomChannel(r.RoomID), uid, sess)
+		if camp, ok := r.campOf(uid); ok {
+			r.JoinChannel(CampChannel(r.RoomID, camp), uid, sess)
+		}
+		r.offline.Store(uid, sess)
+		r.AfterFunc(grace, func() {
+			r.expireDisconnect(uid, sess)
+		})
+	}
+
+	r.Status.Store(snap.Status)
+	r.record(RecordState, 0, StateName(snap.Status), uint32(snap.Status), nil)
+	if snap.Status == RoomStatus_Paused {
+		r.timers.PauseTimers()
+	}
+	return nil
+}
+
+// dropSnapshot 房间关闭时删除快照，关闭的房间不会被恢复
+func (r *BaseRoom) dropSnapshot() {
+	if r.snapshots == nil {
+		return
+	}
+	go func() {
+		if err := r.snapshots.drop(r.RoomID); err != nil {
+			log.Printf("Room %d delete snapshot error: %v", r.RoomID, err)
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package room
+
+import (
+	"errors"
+	"game_actor/session"
+	"time"
+)
+
+var (
+	ErrSpectatorFull      = errors.New("spectator full")
+	ErrPlayerCannotWatch  = errors.New("player cannot spectate own room")
+	ErrSpectatorNoSession = errors.New("spectator session required")
+)
+
+// SpectatorOption 观战者进入、离开房间时通知游戏逻辑
+type SpectatorOption interface {
+	OnSpectatorEnter(roomID int64, uid int64)
+	OnSpectatorLeave(roomID int64, uid int64)
+}
+
+// delayedMsg 观战延迟队列中的消息，at 之后才发送给观战者，msg 和 event 二选一
+type delayedMsg struct {
+	at    time.Time
+	msg   []byte
+	event *event
+}
+
+// SpectatorEnter 以观战者身份进入房间，不计入玩家人数，也不会触发自动开始
+// 已经在观战时使用新的 session 替换旧的
+func (r *BaseRoom) SpectatorEnter(uid int64, sess session.Session) error {
+	if sess == nil {
+		return ErrSpectatorNoSession
+	}
+	if r.isPlayer(uid) {
+		return ErrPlayerCannotWatch
+	}
+	channelID := SpectatorChannel(r.RoomID)
+	if old, loaded := r.spectators.Load(uid); loaded {
+		r.spectators.Store(uid, sess)
+		r.JoinChannel(channelID, uid, sess)
+		if old != sess {
+			old.(session.Session).Close()
+		}
+		return nil
+	}
+	if limit := r.option.maxSpectators; limit > 0 && int(r.spectatorNum.Load()) >= limit {
+		return ErrSpectatorFull
+	}
+	r.spectators.Store(uid, sess)
+	r.spectatorNum.Add(1)
+	r.JoinChannel(channelID, uid, sess)
+
+	for _, opt := range r.option.spectatorOpts {
+		opt.OnSpectatorEnter(r.RoomID, uid)
+	}
+	return nil
+}
+
+// SpectatorLeave 观战者离开房间
+func (r *BaseRoom) SpectatorLeave(uid int64) {
+	if _, loaded := r.spectators.LoadAndDelete(uid); !loaded {
+		return
+	}
+	r.spectatorNum.Add(-1)
+	r.LeaveChannel(SpectatorChannel(r.RoomID), uid)
+	r.notifyMember(uid, false)
+
+	for _, opt := range r.option.spectatorOpts {
+		opt.OnSpectatorLeave(r.RoomID, uid)
+	}
+}
+
+// IsSpectator 是否正在观战
+func (r *BaseRoom) IsSpectator(uid int64) bool {
+	_, ok := r.spectators.Load(uid)
+	return ok
+}
+
+// InRoom 用户是否在房间内，包括已经进入的玩家、其他用户（断线保留期内也算）和观战者
+func (r *BaseRoom) InRoom(uid int64) bool {
+	if _, ok := r.players.Load(uid); ok {
+		return true
+	}
+	return r.IsSpectator(uid)
+}
+
+// SpectatorCount 当前观战人数
+func (r *BaseRoom) SpectatorCount() int {
+	return int(r.spectatorNum.Load())
+}
+
+// feedSpectators 把发给玩家的消息延迟转发给观战者，防止观战者给玩家通风报信
+// 延迟依赖房间定时器，BaseRoom 单独使用（没有 RoomActor）时不延迟
+func (r *BaseRoom) feedSpectators(msg []byte) {
+	r.feedSpectator(delayedMsg{msg: msg})
+}
+
+// feedSpectatorEvent 和 feedSpectators 相同，事件按观战者的 Codec 编码
+func (r *BaseRoom) feedSpectatorEvent(e *event) {
+	r.feedSpectator(delayedMsg{event: e})
+}
+
+func (r *BaseRoom) feedSpectator(m delayedMsg) {
+	if r.spectatorNum.Load() == 0 {
+		return
+	}
+	delay := r.option.spectatorDelay
+	if delay <= 0 || r.timers == nil {
+		r.sendSpectators(m)
+		return
+	}
+	m.at = r.now().Add(delay)
+	r.spectatorQueue = append(r.spectatorQueue, m)
+	if len(r.spectatorQueue) == 1 {
+		r.timers.AfterFunc(delay, r.flushSpectators)
+	}
+}
+
+func (r *BaseRoom) sendSpectators(m delayedMsg) {
+	if m.event != nil {
+		r.broadcastEvent(SpectatorChannel(r.RoomID), m.event)
+		return
+	}
+	r.Broadcast(SpectatorChannel(r.RoomID), m.msg)
+}
+
+// flushSpectators 发送已经到期的观战消息，还有未到期的消息时等待下一条到期
+func (r *BaseRoom) flushSpectators() {
+	now := r.now()
+	n := 0
+	for ; n < len(r.spectatorQueue) && !r.spectatorQueue[n].at.After(now); n++ {
+		r.sendSpectators(r.spectatorQueue[n])
+	}
+	// 释放已发送消息的引用
+	clear(r.spectatorQueue[:n])
+	r.spectatorQueue = r.spectatorQueue[n:]
+	if len(r.spectatorQueue) == 0 {
+		r.spectatorQueue = nil
+		return
+	}
+	r.timers.AfterFunc(r.spectatorQueue[0].at.Sub(now), r.flushSpectators)
+}
@@ -0,0 +1,217 @@
+package room
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 房间生命周期状态，Init/Start/Close 之外的状态由游戏逻辑按需使用
+const (
+	RoomStatus_Loading   = 3 // 加载资源
+	RoomStatus_Countdown = 4 // 开局倒计时
+	RoomStatus_Paused    = 5 // 暂停
+	RoomStatus_Settling  = 6 // 结算
+)
+
+// AnyState 用于 Guard/OnEnter/OnExit，匹配所有状态
+const AnyState int32 = -1
+
+var ErrIllegalTransition = errors.New("illegal room state transition")
+
+// StateName 状态名，用于日志
+func StateName(state int32) string {
+	switch state {
+	case RoomStatus_Init:
+		return "init"
+	case RoomStatus_Start:
+		return "start"
+	case RoomStatus_Close:
+		return "close"
+	case RoomStatus_Loading:
+		return "loading"
+	case RoomStatus_Countdown:
+		return "countdown"
+	case RoomStatus_Paused:
+		return "paused"
+	case RoomStatus_Settling:
+		return "settling"
+	case AnyState:
+		return "any"
+	}
+	return fmt.Sprintf("state(%d)", state)
+}
+
+// Guard 返回错误时拒绝状态切换
+type Guard func(r *BaseRoom, from, to int32) error
+
+// StateHook 进入/离开状态时调用
+type StateHook func(r *BaseRoom, from, to int32)
+
+// StateOption 状态切换通知，每次成功切换后调用
+type StateOption interface {
+	OnStateChange(roomID int64, from, to int32)
+}
+
+type transition struct {
+	from, to int32
+}
+
+type stateHook struct {
+	state int32
+	hook  StateHook
+}
+
+// StateMachine 房间状态机的定义：允许的状态切换、guard 和 enter/exit hook
+// 只保存定义，当前状态保存在 BaseRoom.Status 中，同一个 StateMachine 可以被多个房间共用
+// 需要在创建房间之前配置完成
+type StateMachine struct {
+	transitions map[transition]bool
+	guards      map[transition][]Guard
+	onEnter     []stateHook
+	onExit      []stateHook
+}
+
+func NewStateMachine() *StateMachine {
+	return &StateMachine{
+		transitions: make(map[transition]bool),
+		guards:      make(map[transition][]Guard),
+	}
+}
+
+// DefaultStateMachine 默认的房间状态机
+//
+//	Init -> Loading -> Countdown -> Start <-> Paused
+//	Start/Paused -> Settling
+//	除 Close 之外的所有状态 -> Close
+func DefaultStateMachine() *StateMachine {
+	m := NewStateMachine()
+	m.Allow(RoomStatus_Init, RoomStatus_Loading, RoomStatus_Countdown, RoomStatus_Start)
+	m.Allow(RoomStatus_Loading, RoomStatus_Countdown, RoomStatus_Start)
+	m.Allow(RoomStatus_Countdown, RoomStatus_Start)
+	m.Allow(RoomStatus_Start, RoomStatus_Paused, RoomStatus_Settling)
+	m.Allow(RoomStatus_Paused, RoomStatus_Start, RoomStatus_Settling)
+	for _, state := range []int32{
+		RoomStatus_Init, RoomStatus_Loading, RoomStatus_Countdown,
+		RoomStatus_Start, RoomStatus_Paused, RoomStatus_Settling,
+	} {
+		m.Allow(state, RoomStatus_Close)
+	}
+	return m
+}
+
+// Allow 允许从 from 切换到 to
+func (m *StateMachine) Allow(from int32, to ...int32) *StateMachine {
+	for _, t := range to {
+		m.transitions[transition{from, t}] = true
+	}
+	return m
+}
+
+// Guard 为 from -> to 的切换添加检查，from/to 可以是 AnyState
+func (m *StateMachine) Guard(from, to int32, g Guard) *StateMachine {
+	key := transition{from, to}
+	m.guards[key] = append(m.guards[key], g)
+	return m
+}
+
+// OnEnter 进入 state 时调用，state 可以是 AnyState
+func (m *StateMachine) OnEnter(state int32, h StateHook) *StateMachine {
+	m.onEnter = append(m.onEnter, stateHook{state, h})
+	return m
+}
+
+// OnExit 离开 state 时调用，state 可以是 AnyState
+func (m *StateMachine) OnExit(state int32, h StateHook) *StateMachine {
+	m.onExit = append(m.onExit, stateHook{state, h})
+	return m
+}
+
+// CanTransition 是否允许从 from 切换到 to，不检查 guard
+func (m *StateMachine) CanTransition(from, to int32) bool {
+	return m.transitions[transition{from, to}]
+}
+
+func (m *StateMachine) check(r *BaseRoom, from, to int32) error {
+	// 任何状态都可以关闭，不需要在状态机中声明
+	if !m.CanTransition(from, to) && (to != RoomStatus_Close || from == RoomStatus_Close) {
+		return fmt.Errorf("%w: %s -> %s", ErrIllegalTransition, StateName(from), StateName(to))
+	}
+	for _, key := range []transition{{from, to}, {AnyState, to}, {from, AnyState}, {AnyState, AnyState}} {
+		for _, g := range m.guards[key] {
+			if err := g(r, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func runHooks(hooks []stateHook, state int32, r *BaseRoom, from, to int32) {
+	for _, h := range hooks {
+		if h.state == state || h.state == AnyState {
+			h.hook(r, from, to)
+		}
+	}
+}
+
+// Transition 切换房间状态，不允许的切换或 guard 拒绝时返回错误
+// 顺序为 guard -> 离开旧状态的 hook -> 切换 -> 进入新状态的 hook -> 暂停处理 -> StateOption 通知 -> SetStateHandler 的回调
+func (r *BaseRoom) Transition(to int32) error {
+	m := r.stateMachine()
+	from := r.Status.Load()
+	if err := m.check(r, from, to); err != nil {
+		return err
+	}
+	runHooks(m.onExit, from, r, from, to)
+	if !r.Status.CompareAndSwap(from, to) {
+		return fmt.Errorf("%w: state changed during transition from %s", ErrIllegalTransition, StateName(from))
+	}
+	r.record(RecordState, 0, StateName(to), uint32(to), nil)
+	runHooks(m.onEnter, to, r, from, to)
+	r.onPauseChange(from, to)
+
+	// 兼容原有的 RoomOption 回调
+	switch to {
+	case RoomStatus_Start:
+		if from != RoomStatus_Paused {
+			r.startedAt = r.now()
+			for _, opt := range r.option.roomOpts {
+				opt.OnStart(r.RoomID)
+			}
+		}
+	case RoomStatus_Close:
+		for _, opt := range r.option.roomOpts {
+			opt.OnClose(r.RoomID)
+		}
+		// 游戏逻辑可以在 OnClose 中 SetResult
+		r.settleOnClose()
+		r.dropSnapshot()
+	}
+	for _, opt := range r.option.stateOpts {
+		opt.OnStateChange(r.RoomID, from, to)
+	}
+	if h := r.stateHandler.Load(); h != nil {
+		(*h)(r.RoomID, from, to)
+	}
+	return nil
+}
+
+// SetStateHandler 设置状态切换后的回调，在 StateOption 之后调用
+// RoomService 创建房间时设置，无论切换由谁发起（RoomService、游戏逻辑、玩家全部进入后自动开始）都据此调整自动关闭任务
+func (r *BaseRoom) SetStateHandler(h func(roomID int64, from, to int32)) {
+	r.stateHandler.Store(&h)
+}
+
+// GetStatus 当前状态
+func (r *BaseRoom) GetStatus() int32 {
+	return r.Status.Load()
+}
+
+func (r *BaseRoom) stateMachine() *StateMachine {
+	if r.option.stateMachine != nil {
+		return r.option.stateMachine
+	}
+	return defaultStateMachine
+}
+
+var defaultStateMachine = DefaultStateMachine()
@@ -0,0 +1,89 @@
+package room
+
+import (
+	"fmt"
+	"log"
+)
+
+// SupervisorPolicy 房间 actor 中发生 panic 后的处理方式
+type SupervisorPolicy int
+
+const (
+	// 跳过出错的任务，房间继续运行
+	SuperviseSkip SupervisorPolicy = iota
+	// 通过 RestartFunc 重建房间的游戏状态，玩家和频道保持不变
+	SuperviseRestart
+	// 关闭房间，设置了 close handler 时走 RoomService.CloseRoom
+	SuperviseClose
+)
+
+func (p SupervisorPolicy) String() string {
+	switch p {
+	case SuperviseSkip:
+		return "skip"
+	case SuperviseRestart:
+		return "restart"
+	case SuperviseClose:
+		return "close"
+	}
+	return "unknown"
+}
+
+// RestartFunc 在 actor goroutine 中重建房间的游戏状态，返回错误时房间会被关闭
+type RestartFunc func(r *BaseRoom) error
+
+// SetCloseHandler 设置房间自己发起关闭（监管策略、自动关闭规则）时的回调，RoomService 创建房间时设置为 CloseRoom
+func (r *RoomActor) SetCloseHandler(h func(roomID int64, reason CloseReason)) {
+	r.closeHandler.Store(&h)
+}
+
+// handlePanic 运行在 actor goroutine 中
+func (r *RoomActor) handlePanic(recovered any, stack []byte) {
+	policy := r.option.supervisor
+	if policy == SuperviseRestart && r.option.restart == nil {
+		policy = SuperviseClose
+	}
+	log.Printf("Room %d panic: %v, policy: %s\n%s", r.RoomID, recovered, policy, stack)
+
+	for _, opt := range r.option.panicOpts {
+		r.notifyPanic(opt, recovered, stack, policy)
+	}
+
+	switch policy {
+	case SuperviseRestart:
+		if err := r.restart(); err != nil {
+			log.Printf("Room %d restart failed: %v", r.RoomID, err)
+			r.CloseAsync(CloseCrash)
+		}
+	case SuperviseClose:
+		r.CloseAsync(CloseCrash)
+	}
+}
+
+// notifyPanic 回调自身 panic 时只记录日志
+func (r *RoomActor) notifyPanic(opt PanicOption, recovered any, stack []byte, policy SupervisorPolicy) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("Room %d OnPanic panic: %v", r.RoomID, v)
+		}
+	}()
+	opt.OnPanic(r.RoomID, recovered, stack, policy)
+}
+
+func (r *RoomActor) restart() (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = fmt.Errorf("restart panic: %v", v)
+		}
+	}()
+	return r.option.restart(r.BaseRoom)
+}
+
+// CloseAsync 在新的 goroutine 中关闭房间，可以在房间 actor 中调用，CloseRoom 会同步等待 actor 执行关闭逻辑
+func (r *RoomActor) CloseAsync(reason CloseReason) {
+	if h := r.closeHandler.Load(); h != nil {
+		go (*h)(r.RoomID, reason)
+		return
+	}
+	go r.Close(reason)
+}
@@ -0,0 +1,70 @@
+package room
+
+import (
+	"game_actor/clock"
+	"time"
+)
+
+// 落后超过该帧数时不再追帧，直接以当前时间为基准重新对齐
+const maxTickLagFrames = 5
+
+// tickLoop 固定帧率的时钟，按理想时间轴调度下一帧以抵消执行耗时带来的漂移
+type tickLoop struct {
+	interval time.Duration
+	timer    clock.Timer
+	next     time.Time // 下一帧的理想触发时间
+	last     time.Time // 上一帧的实际触发时间
+	frame    uint64
+}
+
+func newTickLoop(hz int, c clock.Clock) *tickLoop {
+	if hz <= 0 {
+		return nil
+	}
+	interval := time.Second / time.Duration(hz)
+	now := c.Now()
+	return &tickLoop{
+		interval: interval,
+		timer:    c.NewTimer(interval),
+		next:     now.Add(interval),
+		last:     now,
+	}
+}
+
+// C 未开启 tick 时返回 nil channel，select 中永远不会被选中
+func (t *tickLoop) C() <-chan time.Time {
+	if t == nil {
+		return nil
+	}
+	return t.timer.C()
+}
+
+// advance 推进一帧，返回实际间隔和帧号
+func (t *tickLoop) advance(now time.Time) (time.Duration, uint64) {
+	dt := now.Sub(t.last)
+	t.last = now
+	t.frame++
+	t.schedule(now)
+	return dt, t.frame
+}
+
+// idle 房间未运行时只维持节拍，不推进帧号
+func (t *tickLoop) idle(now time.Time) {
+	t.last = now
+	t.schedule(now)
+}
+
+func (t *tickLoop) schedule(now time.Time) {
+	t.next = t.next.Add(t.interval)
+	if now.Sub(t.next) > maxTickLagFrames*t.interval {
+		t.next = now.Add(t.interval)
+	}
+	t.timer.Reset(t.next.Sub(now))
+}
+
+func (t *tickLoop) stop() {
+	if t == nil {
+		return
+	}
+	t.timer.Stop()
+}
@@ -0,0 +1,35 @@
+package router
+
+import (
+	"game_actor/codec"
+	"game_actor/room"
+	"game_actor/session"
+)
+
+// Context 单次请求的上下文
+type Context struct {
+	Session session.Session
+	// 连接使用的 Codec，请求和回包都用它编解码
+	Codec   codec.Codec
+	Request *codec.Envelope
+	// 房间级 handler 中为目标房间，其余 handler 为 nil
+	Room   room.GameRoom
+	values map[string]any
+}
+
+// UID 当前连接绑定的用户
+func (c *Context) UID() int64 {
+	return c.Session.UserID()
+}
+
+func (c *Context) Set(key string, val any) {
+	if c.values == nil {
+		c.values = make(map[string]any)
+	}
+	c.values[key] = val
+}
+
+func (c *Context) Get(key string) (any, bool) {
+	val, ok := c.values[key]
+	return val, ok
+}
@@ -0,0 +1,114 @@
+package router
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnauthenticated = errors.New("unauthenticated")
+	ErrRateLimited     = errors.New("rate limited")
+)
+
+// Logging 记录每个请求的路由、房间、用户和耗时
+func Logging() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (any, error) {
+			start := time.Now()
+			res, err := next(ctx)
+			req := ctx.Request
+			if err != nil {
+				log.Printf("Action: %s, MsgID: %d, Room: %d, UID: %d, Cost: %v, Error: %v",
+					req.Route, req.MsgID, req.RoomID, ctx.UID(), time.Since(start), err)
+			} else {
+				log.Printf("Action: %s, MsgID: %d, Room: %d, UID: %d, Cost: %v",
+					req.Route, req.MsgID, req.RoomID, ctx.UID(), time.Since(start))
+			}
+			return res, err
+		}
+	}
+}
+
+// Auth 要求连接已经绑定用户
+func Auth() Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (any, error) {
+			if ctx.UID() == 0 {
+				return nil, ErrUnauthenticated
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// RateLimit 按连接限流（令牌桶），rate 为每秒补充的令牌数，burst 为桶容量
+func RateLimit(rate float64, burst int) Middleware {
+	limiter := &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx *Context) (any, error) {
+			if !limiter.allow(ctx.Session.ID()) {
+				return nil, ErrRateLimited
+			}
+			return next(ctx)
+		}
+	}
+}
+
+// 超过该时间没有请求的令牌桶会被清理
+const bucketIdleTimeout = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*bucket // sessionID -> bucket
+	sweepAt time.Time
+}
+
+func (l *rateLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// sweep 清理断开连接遗留的令牌桶
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Before(l.sweepAt) {
+		return
+	}
+	l.sweepAt = now.Add(bucketIdleTimeout)
+	for key, b := range l.buckets {
+		if now.Sub(b.last) > bucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
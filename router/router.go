@@ -0,0 +1,188 @@
+package router
+
+import (
+	"errors"
+	"game_actor/codec"
+	"game_actor/room"
+	"game_actor/session"
+	"log"
+)
+
+var (
+	ErrUnknownRoute = errors.New("unknown action")
+	ErrRoomNotFound = errors.New("room not found")
+)
+
+// HeartbeatAction 应用层心跳，不经过中间件直接回一个空包（带回 Seq，客户端可据此计算 RTT）
+// 用于无法处理 WebSocket ping/pong 的客户端和 TCP 连接，收到任何消息都会顺延连接的读超时
+const HeartbeatAction = "heartbeat"
+
+// HandlerFunc 返回值会作为回包的 Data
+type HandlerFunc func(ctx *Context) (any, error)
+
+// Middleware 包装 handler，用于鉴权、日志、限流等
+type Middleware func(next HandlerFunc) HandlerFunc
+
+// RoomLookup 根据 RoomID 查找房间，一般为 RoomService.GetRoom
+type RoomLookup func(roomID int64) (room.GameRoom, bool)
+
+// invoker 能把任务投递到房间 actor 中执行，RoomActor 实现了该接口
+type invoker interface {
+	Invoke(f func()) error
+}
+
+// inboundRecorder 能录制客户端消息的房间，见 room.WithRecorder
+type inboundRecorder interface {
+	RecordInbound(uid int64, route string, msgID uint32, payload []byte)
+}
+
+type route struct {
+	handler    HandlerFunc
+	roomScoped bool
+}
+
+type Router struct {
+	lookup      RoomLookup
+	middlewares []Middleware
+	byAction    map[string]*route
+	byID        map[uint32]*route
+}
+
+func New(lookup RoomLookup) *Router {
+	return &Router{
+		lookup:   lookup,
+		byAction: make(map[string]*route),
+		byID:     make(map[uint32]*route),
+	}
+}
+
+// Use 注册全局中间件，对之后注册的 handler 生效
+func (r *Router) Use(mws ...Middleware) {
+	r.middlewares = append(r.middlewares, mws...)
+}
+
+// Handle 按 action 注册 handler，在网络读 goroutine 中执行
+func (r *Router) Handle(action string, h HandlerFunc, mws ...Middleware) {
+	r.byAction[action] = r.newRoute(h, false, mws)
+}
+
+// HandleID 按消息 ID 注册 handler
+func (r *Router) HandleID(msgID uint32, h HandlerFunc, mws ...Middleware) {
+	r.byID[msgID] = r.newRoute(h, false, mws)
+}
+
+// HandleRoom 按 action 注册房间级 handler，handler 在目标 RoomActor 的 mailbox 中执行
+func (r *Router) HandleRoom(action string, h HandlerFunc, mws ...Middleware) {
+	r.byAction[action] = r.newRoute(h, true, mws)
+}
+
+// HandleRoomID 按消息 ID 注册房间级 handler
+func (r *Router) HandleRoomID(msgID uint32, h HandlerFunc, mws ...Middleware) {
+	r.byID[msgID] = r.newRoute(h, true, mws)
+}
+
+func (r *Router) newRoute(h HandlerFunc, roomScoped bool, mws []Middleware) *route {
+	// 全局中间件在外层，路由中间件在内层
+	all := append(append([]Middleware{}, r.middlewares...), mws...)
+	for i := len(all) - 1; i >= 0; i-- {
+		h = all[i](h)
+	}
+	return &route{handler: h, roomScoped: roomScoped}
+}
+
+// Dispatch 解析消息并分发到对应的 handler
+func (r *Router) Dispatch(sess session.Session, msg []byte) {
+	c := codec.FromSession(sess)
+	req, err := c.Decode(msg)
+	if err != nil {
+		log.Printf("Invalid message format from %s: %v", sess.ID(), err)
+		return
+	}
+	ctx := &Context{Session: sess, Codec: c, Request: req}
+
+	rt := r.match(req)
+	if rt == nil && req.Route == HeartbeatAction {
+		reply(ctx, nil, nil)
+		return
+	}
+	if rt == nil {
+		reply(ctx, nil, ErrUnknownRoute)
+		return
+	}
+	if !rt.roomScoped {
+		res, err := rt.handler(ctx)
+		reply(ctx, res, err)
+		return
+	}
+
+	gameRoom, ok := r.lookup(req.RoomID)
+	if !ok {
+		reply(ctx, nil, ErrRoomNotFound)
+		return
+	}
+	inv, ok := gameRoom.(invoker)
+	if !ok {
+		reply(ctx, nil, errors.New("room does not support invoke"))
+		return
+	}
+	ctx.Room = gameRoom
+	rec, _ := gameRoom.(inboundRecorder)
+	err = inv.Invoke(func() {
+		if rec != nil {
+			rec.RecordInbound(ctx.UID(), req.Route, req.MsgID, req.Payload)
+		}
+		res, err := rt.handler(ctx)
+		reply(ctx, res, err)
+	})
+	if err != nil {
+		reply(ctx, nil, err)
+	}
+}
+
+func (r *Router) match(req *codec.Envelope) *route {
+	if req.MsgID != 0 {
+		if rt, ok := r.byID[req.MsgID]; ok {
+			return rt
+		}
+	}
+	return r.byAction[req.Route]
+}
+
+// reply 回包带回请求的 Seq、MsgID 和 Route，处理失败时只带 Error
+func reply(ctx *Context, data any, err error) {
+	resp := &codec.Envelope{
+		Seq:    ctx.Request.Seq,
+		MsgID:  ctx.Request.MsgID,
+		Route:  ctx.Request.Route,
+		RoomID: ctx.Request.RoomID,
+	}
+	if err == nil && data != nil {
+		resp.Payload, err = ctx.Codec.Marshal(data)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	msg, err := ctx.Codec.Encode(resp)
+	if err != nil {
+		log.Printf("Encode response error: %v", err)
+		return
+	}
+	ctx.Session.Send(msg)
+}
+
+// Typed 把强类型的 handler 转成 HandlerFunc，使用连接的 Codec 解码请求 Payload
+func Typed[Req any, Resp any](h func(ctx *Context, req *Req) (*Resp, error)) HandlerFunc {
+	return func(ctx *Context) (any, error) {
+		req := new(Req)
+		if len(ctx.Request.Payload) > 0 {
+			if err := ctx.Codec.Unmarshal(ctx.Request.Payload, req); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := h(ctx, req)
+		if err != nil || resp == nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+}
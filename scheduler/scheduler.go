@@ -0,0 +1,265 @@
+// Package scheduler 房间生命周期使用的一次性定时任务调度
+package scheduler
+
+import (
+	"container/heap"
+	"game_actor/clock"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 房间生命周期任务的名称
+const (
+	NameStart = "start"
+	NameClose = "close"
+)
+
+// Key 任务标识，同一个房间内 Name 唯一
+type Key struct {
+	RoomID int64
+	Name   string
+}
+
+// Entry 等待执行的任务
+type Entry struct {
+	Key      Key
+	Deadline time.Time
+	// 房间暂停中，Deadline 为空，恢复后 Remaining 之后执行
+	Paused    bool
+	Remaining time.Duration
+}
+
+// Scheduler 一次性定时任务，任务执行后自动移除
+type Scheduler interface {
+	// After d 之后执行 f，相同 Key 的任务已存在时替换旧任务
+	After(key Key, d time.Duration, f func())
+	// Cancel 取消任务，任务不存在或已经执行时返回 false
+	Cancel(key Key) bool
+	// CancelRoom 取消房间的所有任务，返回取消的数量
+	CancelRoom(roomID int64) int
+	// Pause 暂停房间的所有任务，返回暂停的数量
+	Pause(roomID int64) int
+	// Resume 恢复房间暂停的任务，剩余时间和暂停时一致
+	Resume(roomID int64) int
+	// Entries 房间等待执行的任务（包括暂停中的），按剩余时间排序
+	Entries(roomID int64) []Entry
+	// Stop 停止调度，未执行的任务全部丢弃
+	Stop()
+}
+
+type job struct {
+	key   Key
+	at    time.Time
+	f     func()
+	index int
+	// 暂停时剩余的时间
+	remaining time.Duration
+}
+
+type jobHeap []*job
+
+func (h jobHeap) Len() int           { return len(h) }
+func (h jobHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+func (h jobHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *jobHeap) Push(x any) {
+	j := x.(*job)
+	j.index = len(*h)
+	*h = append(*h, j)
+}
+
+func (h *jobHeap) Pop() any {
+	old := *h
+	j := old[len(old)-1]
+	old[len(old)-1] = nil
+	j.index = -1
+	*h = old[:len(old)-1]
+	return j
+}
+
+// HeapScheduler 最小堆实现的 Scheduler，只用一个 timer 唤醒
+// 任务在独立的 goroutine 中执行，不会阻塞其他任务
+type HeapScheduler struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	jobs  jobHeap
+	byKey map[Key]*job
+	// 暂停中的任务，不在堆中
+	paused map[Key]*job
+	wake   clock.Timer
+	stop   chan struct{}
+	once   sync.Once
+}
+
+func New(c clock.Clock) *HeapScheduler {
+	wake := c.NewTimer(time.Hour)
+	wake.Stop()
+	s := &HeapScheduler{
+		clock:  c,
+		byKey:  make(map[Key]*job),
+		paused: make(map[Key]*job),
+		wake:   wake,
+		stop:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *HeapScheduler) After(key Key, d time.Duration, f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.byKey[key]; ok {
+		heap.Remove(&s.jobs, old.index)
+	}
+	delete(s.paused, key)
+	s.push(&job{key: key, at: s.clock.Now().Add(d), f: f}, d)
+}
+
+// push 调用方需要持有锁
+func (s *HeapScheduler) push(j *job, d time.Duration) {
+	heap.Push(&s.jobs, j)
+	s.byKey[j.key] = j
+	if j.index == 0 {
+		s.wake.Reset(d)
+	}
+}
+
+func (s *HeapScheduler) Cancel(key Key) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.paused[key]; ok {
+		delete(s.paused, key)
+		return true
+	}
+	j, ok := s.byKey[key]
+	if !ok {
+		return false
+	}
+	s.remove(j)
+	return true
+}
+
+func (s *HeapScheduler) CancelRoom(roomID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for key, j := range s.byKey {
+		if key.RoomID == roomID {
+			s.remove(j)
+			n++
+		}
+	}
+	for key := range s.paused {
+		if key.RoomID == roomID {
+			delete(s.paused, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *HeapScheduler) Pause(roomID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	n := 0
+	for key, j := range s.byKey {
+		if key.RoomID == roomID {
+			s.remove(j)
+			j.remaining = max(j.at.Sub(now), 0)
+			s.paused[key] = j
+			n++
+		}
+	}
+	return n
+}
+
+func (s *HeapScheduler) Resume(roomID int64) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	n := 0
+	for key, j := range s.paused {
+		if key.RoomID == roomID {
+			delete(s.paused, key)
+			j.at = now.Add(j.remaining)
+			s.push(j, j.remaining)
+			n++
+		}
+	}
+	return n
+}
+
+func (s *HeapScheduler) Entries(roomID int64) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []Entry
+	now := s.clock.Now()
+	for key, j := range s.byKey {
+		if key.RoomID == roomID {
+			entries = append(entries, Entry{Key: key, Deadline: j.at, Remaining: j.at.Sub(now)})
+		}
+	}
+	for key, j := range s.paused {
+		if key.RoomID == roomID {
+			entries = append(entries, Entry{Key: key, Paused: true, Remaining: j.remaining})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Remaining < entries[j].Remaining
+	})
+	return entries
+}
+
+func (s *HeapScheduler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+		s.mu.Lock()
+		s.jobs = nil
+		s.byKey = make(map[Key]*job)
+		s.paused = make(map[Key]*job)
+		s.wake.Stop()
+		s.mu.Unlock()
+	})
+}
+
+// remove 调用方需要持有锁
+func (s *HeapScheduler) remove(j *job) {
+	heap.Remove(&s.jobs, j.index)
+	delete(s.byKey, j.key)
+}
+
+func (s *HeapScheduler) run() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.wake.C():
+			// 使用当前时间而不是触发时间，唤醒被延迟处理时下一次唤醒不会跟着推后
+			for _, j := range s.due(s.clock.Now()) {
+				go j.f()
+			}
+		}
+	}
+}
+
+// due 取出所有到期的任务，并把 timer 设置为下一个任务的到期时间
+func (s *HeapScheduler) due(now time.Time) []*job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var fired []*job
+	for len(s.jobs) > 0 && !s.jobs[0].at.After(now) {
+		j := heap.Pop(&s.jobs).(*job)
+		delete(s.byKey, j.key)
+		fired = append(fired, j)
+	}
+	if len(s.jobs) > 0 {
+		s.wake.Reset(s.jobs[0].at.Sub(now))
+	}
+	return fired
+}
@@ -0,0 +1,201 @@
+package scheduler_test
+
+import (
+	"game_actor/clock"
+	"game_actor/scheduler"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fixture 使用 clock.Fake 的调度器，任务执行时把名字写入 fired
+type fixture struct {
+	s     *scheduler.HeapScheduler
+	clock *clock.Fake
+	fired chan scheduler.Key
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	c := clock.NewFake(epoch)
+	s := scheduler.New(c)
+	t.Cleanup(s.Stop)
+	return &fixture{s: s, clock: c, fired: make(chan scheduler.Key, 16)}
+}
+
+func (f *fixture) after(roomID int64, name string, d time.Duration) {
+	key := scheduler.Key{RoomID: roomID, Name: name}
+	f.s.After(key, d, func() {
+		f.fired <- key
+	})
+}
+
+// expect 等待任务依次执行，任务在独立的 goroutine 中执行，同一批到期的任务不保证顺序
+func (f *fixture) expect(t *testing.T, want ...scheduler.Key) {
+	t.Helper()
+	got := make(map[scheduler.Key]bool)
+	for range want {
+		select {
+		case key := <-f.fired:
+			got[key] = true
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %v, fired %v", want, got)
+		}
+	}
+	for _, key := range want {
+		if !got[key] {
+			t.Fatalf("fired %v, want %v", got, want)
+		}
+	}
+}
+
+// expectNone 虚拟时间还没到下一个任务时 wake timer 不会触发，不需要等待
+func (f *fixture) expectNone(t *testing.T) {
+	t.Helper()
+	select {
+	case key := <-f.fired:
+		t.Fatalf("unexpected job %v", key)
+	default:
+	}
+}
+
+func (f *fixture) entries(t *testing.T, roomID int64, want ...scheduler.Entry) {
+	t.Helper()
+	got := f.s.Entries(roomID)
+	if len(got) != len(want) {
+		t.Fatalf("entries %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("entry %d: %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func key(roomID int64, name string) scheduler.Key {
+	return scheduler.Key{RoomID: roomID, Name: name}
+}
+
+func TestSchedulerAfter(t *testing.T) {
+	f := newFixture(t)
+	f.after(1, scheduler.NameClose, 10*time.Second)
+	f.after(1, scheduler.NameStart, 5*time.Second)
+	f.entries(t, 1,
+		scheduler.Entry{Key: key(1, scheduler.NameStart), Deadline: epoch.Add(5 * time.Second), Remaining: 5 * time.Second},
+		scheduler.Entry{Key: key(1, scheduler.NameClose), Deadline: epoch.Add(10 * time.Second), Remaining: 10 * time.Second},
+	)
+
+	f.clock.Advance(4 * time.Second)
+	f.expectNone(t)
+	f.clock.Advance(time.Second)
+	f.expect(t, key(1, scheduler.NameStart))
+	f.entries(t, 1,
+		scheduler.Entry{Key: key(1, scheduler.NameClose), Deadline: epoch.Add(10 * time.Second), Remaining: 5 * time.Second},
+	)
+
+	f.clock.Advance(5 * time.Second)
+	f.expect(t, key(1, scheduler.NameClose))
+	f.entries(t, 1)
+}
+
+// 相同 Key 的任务替换旧任务，旧任务不再执行
+func TestSchedulerReplace(t *testing.T) {
+	f := newFixture(t)
+	f.after(1, scheduler.NameClose, 5*time.Second)
+	f.after(1, scheduler.NameClose, 10*time.Second)
+
+	f.clock.Advance(5 * time.Second)
+	f.expectNone(t)
+	f.entries(t, 1,
+		scheduler.Entry{Key: key(1, scheduler.NameClose), Deadline: epoch.Add(10 * time.Second), Remaining: 5 * time.Second},
+	)
+	f.clock.Advance(5 * time.Second)
+	f.expect(t, key(1, scheduler.NameClose))
+}
+
+func TestSchedulerCancel(t *testing.T) {
+	f := newFixture(t)
+	f.after(1, scheduler.NameStart, 5*time.Second)
+	f.after(1, scheduler.NameClose, 10*time.Second)
+	f.after(2, scheduler.NameClose, 10*time.Second)
+
+	if !f.s.Cancel(key(1, scheduler.NameStart)) {
+		t.Fatal("cancel pending job returned false")
+	}
+	if f.s.Cancel(key(1, scheduler.NameStart)) {
+		t.Fatal("cancel twice returned true")
+	}
+	f.clock.Advance(5 * time.Second)
+	f.expectNone(t)
+
+	if n := f.s.CancelRoom(1); n != 1 {
+		t.Fatalf("cancelled %d jobs, want 1", n)
+	}
+	f.entries(t, 1)
+	f.clock.Advance(5 * time.Second)
+	f.expect(t, key(2, scheduler.NameClose))
+	if f.s.Cancel(key(2, scheduler.NameClose)) {
+		t.Fatal("cancel executed job returned true")
+	}
+}
+
+// 暂停的任务保留剩余时间，恢复后从恢复时开始计时，其他房间不受影响
+func TestSchedulerPause(t *testing.T) {
+	f := newFixture(t)
+	f.after(1, scheduler.NameClose, 10*time.Second)
+	f.after(2, scheduler.NameClose, 20*time.Second)
+
+	f.clock.Advance(4 * time.Second)
+	if n := f.s.Pause(1); n != 1 {
+		t.Fatalf("paused %d jobs, want 1", n)
+	}
+	f.entries(t, 1, scheduler.Entry{Key: key(1, scheduler.NameClose), Paused: true, Remaining: 6 * time.Second})
+
+	f.clock.Advance(16 * time.Second)
+	f.expect(t, key(2, scheduler.NameClose))
+	f.clock.Advance(80 * time.Second)
+	f.expectNone(t)
+
+	if n := f.s.Resume(1); n != 1 {
+		t.Fatalf("resumed %d jobs, want 1", n)
+	}
+	if n := f.s.Resume(1); n != 0 {
+		t.Fatalf("resumed %d jobs twice", n)
+	}
+	f.entries(t, 1,
+		scheduler.Entry{Key: key(1, scheduler.NameClose), Deadline: epoch.Add(106 * time.Second), Remaining: 6 * time.Second},
+	)
+	f.clock.Advance(5 * time.Second)
+	f.expectNone(t)
+	f.clock.Advance(time.Second)
+	f.expect(t, key(1, scheduler.NameClose))
+}
+
+// 暂停中的任务可以取消，也会被同 Key 的新任务替换
+func TestSchedulerCancelPaused(t *testing.T) {
+	f := newFixture(t)
+	f.after(1, scheduler.NameStart, 5*time.Second)
+	f.after(1, scheduler.NameClose, 10*time.Second)
+	f.s.Pause(1)
+
+	if !f.s.Cancel(key(1, scheduler.NameStart)) {
+		t.Fatal("cancel paused job returned false")
+	}
+	f.after(1, scheduler.NameClose, 3*time.Second)
+	f.entries(t, 1,
+		scheduler.Entry{Key: key(1, scheduler.NameClose), Deadline: epoch.Add(3 * time.Second), Remaining: 3 * time.Second},
+	)
+	if n := f.s.Resume(1); n != 0 {
+		t.Fatalf("resumed %d replaced jobs", n)
+	}
+	f.clock.Advance(3 * time.Second)
+	f.expect(t, key(1, scheduler.NameClose))
+
+	f.after(1, scheduler.NameClose, 10*time.Second)
+	f.s.Pause(1)
+	if n := f.s.CancelRoom(1); n != 1 {
+		t.Fatalf("cancelled %d paused jobs, want 1", n)
+	}
+	f.entries(t, 1)
+}
@@ -1,38 +1,93 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"game_actor/actor"
+	"game_actor/clock"
 	"game_actor/match"
 	"game_actor/room"
+	"game_actor/scheduler"
 	"game_actor/session"
+	"game_actor/snapshot"
+	"log"
 	"sync"
 	"time"
-
-	"github.com/go-co-op/gocron"
 )
 
 type KickPublisher func(uid int64)
 
 type Builder func(roomID int64, matchInfo *match.MatchInfo) room.GameRoom
 
+// RemoveHook 房间从本节点移除（关闭或迁移到其他节点）后调用
+type RemoveHook func(roomID int64, matchInfo *match.MatchInfo)
+
+// ErrTransferUnknown Transfer 无法确定目标节点是否已经接管房间，如目标节点取走快照后没有回复
+// 此时房间不能在本节点继续运行，MigrateRoom 会移除本地房间并返回该错误，需要人工确认目标节点的状态
+var ErrTransferUnknown = errors.New("migration result unknown")
+
 type RoomService struct {
 	Rooms       sync.Map
 	UserRoomMap sync.Map // uid -> roomID (global tracking for this node)
+	// 本节点的 actor，房间的 actor 以 room.ActorKind 注册，停止后自动注销
+	Actors *actor.Registry
 
 	Builder       Builder
-	scheduler     *gocron.Scheduler
+	scheduler     scheduler.Scheduler
+	clock         clock.Clock
 	kickPublisher KickPublisher
+	removeHook    RemoveHook
+}
+
+type OptionFunc func(*RoomService)
+
+// WithScheduler 替换房间生命周期调度器，测试中可以配合 clock.Fake 在虚拟时间中运行
+func WithScheduler(sched scheduler.Scheduler) OptionFunc {
+	return func(s *RoomService) {
+		s.scheduler = sched
+	}
+}
+
+// WithClock 恢复房间时计算剩余时间使用的时钟，同时作为默认调度器的时钟
+func WithClock(c clock.Clock) OptionFunc {
+	return func(s *RoomService) {
+		s.clock = c
+	}
 }
 
-func NewRoomService(builder Builder, kickPublisher KickPublisher) *RoomService {
-	s := gocron.NewScheduler(time.UTC)
-	s.StartAsync()
-	return &RoomService{
+// WithRegistry 使用节点共用的 actor 注册表，默认每个 RoomService 创建自己的
+func WithRegistry(registry *actor.Registry) OptionFunc {
+	return func(s *RoomService) {
+		s.Actors = registry
+	}
+}
+
+// WithRemoveHook 房间关闭或迁移走之后通知调用方，如清理外部的用户路由
+func WithRemoveHook(h RemoveHook) OptionFunc {
+	return func(s *RoomService) {
+		s.removeHook = h
+	}
+}
+
+func NewRoomService(builder Builder, kickPublisher KickPublisher, opts ...OptionFunc) *RoomService {
+	s := &RoomService{
 		Builder:       builder,
-		scheduler:     s,
 		kickPublisher: kickPublisher,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.clock == nil {
+		s.clock = clock.Real
+	}
+	if s.scheduler == nil {
+		s.scheduler = scheduler.New(s.clock)
+	}
+	if s.Actors == nil {
+		s.Actors = actor.NewRegistry()
+	}
+	return s
 }
 
 func (s *RoomService) CreateRoom(roomID int64, matchInfo *match.MatchInfo) (room.GameRoom, error) {
@@ -41,24 +96,233 @@ func (s *RoomService) CreateRoom(roomID int64, matchInfo *match.MatchInfo) (room
 		return nil, errors.New("room already exist")
 	}
 	gameRoom := s.Builder(roomID, matchInfo)
-	_, ok = s.Rooms.LoadOrStore(roomID, gameRoom)
-	if ok {
-		return nil, errors.New("room already exist")
+	if err := s.addRoom(roomID, gameRoom); err != nil {
+		return nil, err
 	}
 
 	// 1. 创建房间之后，根据matchInfo里面的最长等待playMaxWait，判断是否要开始游戏
 	if matchInfo.MaxPlayerWaitTime > 0 {
-		// 使用 gocron 调度自动开始任务
-		// Tag: room-{id}, room-{id}-start
-		s.scheduler.Every(matchInfo.MaxPlayerWaitTime).Seconds().LimitRunsTo(1).Tag(
-			fmt.Sprintf("room-%d", roomID),
-			fmt.Sprintf("room-%d-start", roomID),
-		).Do(s.StartRoom, roomID)
+		s.scheduler.After(scheduler.Key{RoomID: roomID, Name: scheduler.NameStart}, seconds(matchInfo.MaxPlayerWaitTime), func() {
+			s.startOrClose(roomID)
+		})
 	}
 
 	return gameRoom, nil
 }
 
+func (s *RoomService) addRoom(roomID int64, gameRoom room.GameRoom) error {
+	if _, loaded := s.Rooms.LoadOrStore(roomID, gameRoom); loaded {
+		return errors.New("room already exist")
+	}
+	// 同 ID 的旧房间已经移除，它的 actor 可能还没有注销完，直接替换
+	if r, ok := gameRoom.(interface{ Actor() *actor.Actor[func()] }); ok {
+		s.Actors.Unregister(room.ActorKind, roomID)
+		s.Actors.Register(r.Actor())
+	}
+	// 房间因 panic、自动关闭规则等原因需要自行关闭时，统一走 CloseRoom 清理调度任务
+	if r, ok := gameRoom.(interface {
+		SetCloseHandler(func(roomID int64, reason room.CloseReason))
+	}); ok {
+		r.SetCloseHandler(func(roomID int64, reason room.CloseReason) {
+			s.CloseRoom(roomID, reason)
+		})
+	}
+	// 断线超时等由房间自己移除的用户，清理 UserRoomMap；用户已经进入其他房间时保留新的记录
+	// 进入时补上被之前的离开删掉的记录（如保留期刚好结束时重新进入）
+	if r, ok := gameRoom.(interface {
+		SetMemberHandler(func(roomID int64, uid int64, entered bool))
+	}); ok {
+		r.SetMemberHandler(func(roomID int64, uid int64, entered bool) {
+			if entered {
+				s.UserRoomMap.LoadOrStore(uid, roomID)
+				return
+			}
+			s.UserRoomMap.CompareAndDelete(uid, roomID)
+		})
+	}
+	// 自动关闭任务跟随房间的状态切换，直接调用 GameRoom 的 Start/Pause/Resume 或玩家全部进入后自动开始时同样生效
+	if r, ok := gameRoom.(interface {
+		SetStateHandler(func(roomID int64, from, to int32))
+	}); ok {
+		r.SetStateHandler(s.onStateChange)
+	}
+	return nil
+}
+
+// onStateChange 房间开始游戏后添加自动关闭任务，暂停期间自动关闭倒计时停止，恢复后顺延暂停的时长
+// 在房间的 actor goroutine 中调用
+func (s *RoomService) onStateChange(roomID int64, from, to int32) {
+	switch {
+	case to == room.RoomStatus_Paused:
+		s.scheduler.Pause(roomID)
+	case from == room.RoomStatus_Paused && to != room.RoomStatus_Close:
+		s.scheduler.Resume(roomID)
+	case to == room.RoomStatus_Start:
+		// 取消自动开始任务（手动开始或玩家全部进入，防止重复触发）
+		s.scheduler.Cancel(scheduler.Key{RoomID: roomID, Name: scheduler.NameStart})
+		gameRoom, ok := s.GetRoom(roomID)
+		if !ok {
+			return
+		}
+		// 2. 游戏开始之后，要根据游戏最长时间，要自动关闭游戏
+		if matchInfo := gameRoom.GetMatchInfo(); matchInfo != nil && matchInfo.MaxGameTime > 0 {
+			s.scheduler.After(scheduler.Key{RoomID: roomID, Name: scheduler.NameClose}, seconds(matchInfo.MaxGameTime), func() {
+				s.CloseRoom(roomID, room.CloseTimeout)
+			})
+		}
+	}
+}
+
+// RestoreRooms 节点重启后从快照中恢复房间，房间由 Builder 创建，需要支持 RestoreSnapshot（如 RoomActor）
+// 玩家重新进入房间时按断线重连处理；自动开始和自动关闭的时间从房间创建和开始游戏时算起，自动关闭顺延暂停的时长
+// 恢复失败的房间按 CloseCrash 关闭，单个房间失败不影响其他房间，返回恢复成功的房间
+func (s *RoomService) RestoreRooms(ctx context.Context, store snapshot.Store) ([]int64, error) {
+	roomIDs, err := store.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		restored []int64
+		errs     []error
+	)
+	for _, roomID := range roomIDs {
+		err := s.restoreFrom(ctx, store, roomID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("restore room %d: %w", roomID, err))
+			continue
+		}
+		restored = append(restored, roomID)
+	}
+	return restored, errors.Join(errs...)
+}
+
+func (s *RoomService) restoreFrom(ctx context.Context, store snapshot.Store, roomID int64) error {
+	snap, err := store.Load(ctx, roomID)
+	if err != nil {
+		return err
+	}
+	return s.RestoreRoom(snap)
+}
+
+// RestoreRoom 用快照在本节点创建房间，用于崩溃恢复和接收迁移过来的房间，见 RestoreRooms
+func (s *RoomService) RestoreRoom(snap *snapshot.Snapshot) error {
+	roomID := snap.RoomID
+	if snap.MatchInfo == nil {
+		return errors.New("snapshot without match info")
+	}
+	if _, ok := s.Rooms.Load(roomID); ok {
+		return errors.New("room already exist")
+	}
+	gameRoom := s.Builder(roomID, snap.MatchInfo)
+	if err := s.addRoom(roomID, gameRoom); err != nil {
+		return err
+	}
+	r, ok := gameRoom.(interface {
+		RestoreSnapshot(snap *snapshot.Snapshot) error
+	})
+	var err error
+	if !ok {
+		err = errors.New("room does not support snapshot")
+	} else {
+		err = r.RestoreSnapshot(snap)
+	}
+	if err != nil {
+		s.CloseRoom(roomID, room.CloseCrash)
+		return err
+	}
+
+	for _, uid := range snap.Players {
+		s.UserRoomMap.Store(uid, roomID)
+	}
+	now := s.clock.Now()
+	switch snap.Status {
+	case room.RoomStatus_Init:
+		if snap.MatchInfo.MaxPlayerWaitTime > 0 {
+			deadline := snap.CreatedAt.Add(seconds(snap.MatchInfo.MaxPlayerWaitTime))
+			s.scheduler.After(scheduler.Key{RoomID: roomID, Name: scheduler.NameStart}, max(deadline.Sub(now), 0), func() {
+				s.startOrClose(roomID)
+			})
+		}
+	default:
+		if snap.MatchInfo.MaxGameTime > 0 && !snap.StartedAt.IsZero() {
+			deadline := snap.StartedAt.Add(seconds(snap.MatchInfo.MaxGameTime) + snap.Paused)
+			// 暂停中的房间时间停在快照时，恢复后剩余时间再继续计算
+			if snap.Status == room.RoomStatus_Paused {
+				now = snap.At
+			}
+			s.scheduler.After(scheduler.Key{RoomID: roomID, Name: scheduler.NameClose}, max(deadline.Sub(now), 0), func() {
+				s.CloseRoom(roomID, room.CloseTimeout)
+			})
+		}
+		if snap.Status == room.RoomStatus_Paused {
+			s.scheduler.Pause(roomID)
+		}
+	}
+	return nil
+}
+
+// Transfer 把冻结房间时生成的快照交给目标节点恢复，返回 nil 表示目标节点已经接管房间
+// 目标节点可能已经接管时返回包装了 ErrTransferUnknown 的错误，其他错误表示目标节点没有接管
+type Transfer func(ctx context.Context, snap *snapshot.Snapshot) error
+
+// migratable 支持迁移的房间，RoomActor 实现了该接口
+type migratable interface {
+	Freeze() (*snapshot.Snapshot, error)
+	Thaw() error
+	Detach(notify room.NotifyFunc) error
+}
+
+// MigrateRoom 把房间迁移到其他节点：冻结房间 -> transfer 交给目标节点恢复 -> 通知客户端并移除本地房间
+// transfer 失败时房间解冻继续运行，冻结的时长由 ctx 控制；notify 返回发给每个用户的迁移通知（如新节点地址和续连凭证）
+// transfer 返回 ErrTransferUnknown 时不解冻，避免两个节点同时运行房间：本地房间照常通知客户端后移除，并返回该错误
+func (s *RoomService) MigrateRoom(ctx context.Context, roomID int64, transfer Transfer, notify room.NotifyFunc) error {
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok {
+		return errors.New("room not exist")
+	}
+	r, ok := gameRoom.(migratable)
+	if !ok {
+		return errors.New("room does not support migration")
+	}
+	snap, err := r.Freeze()
+	if err != nil {
+		return err
+	}
+	// 冻结期间暂停生命周期任务，避免自动关闭等待冻结的房间
+	s.scheduler.Pause(roomID)
+	err = transfer(ctx, snap)
+	if err != nil && !errors.Is(err, ErrTransferUnknown) {
+		if snap.Status != room.RoomStatus_Paused {
+			s.scheduler.Resume(roomID)
+		}
+		r.Thaw()
+		return err
+	}
+	if err != nil {
+		log.Printf("Room %d migration result unknown, detaching local room: %v", roomID, err)
+	}
+
+	s.scheduler.CancelRoom(roomID)
+	s.Rooms.Delete(roomID)
+	s.UserRoomMap.Range(func(key, value any) bool {
+		if value.(int64) == roomID {
+			s.UserRoomMap.Delete(key)
+		}
+		return true
+	})
+	if detachErr := r.Detach(notify); detachErr != nil {
+		err = errors.Join(err, detachErr)
+	}
+	s.removed(roomID, snap.MatchInfo)
+	return err
+}
+
+func (s *RoomService) removed(roomID int64, matchInfo *match.MatchInfo) {
+	if s.removeHook != nil {
+		s.removeHook(roomID, matchInfo)
+	}
+}
+
 func (s *RoomService) GetRoom(roomID int64) (room.GameRoom, bool) {
 	gameRoom, ok := s.Rooms.Load(roomID)
 	if !ok {
@@ -74,44 +338,93 @@ func (s *RoomService) StartRoom(roomID int64) error {
 	}
 
 	// 取消自动开始任务（如果是手动开始的，防止重复触发）
-	s.scheduler.RemoveByTag(fmt.Sprintf("room-%d-start", roomID))
+	s.scheduler.Cancel(scheduler.Key{RoomID: roomID, Name: scheduler.NameStart})
 	// 判断是否需要开始游戏
 	if !gameRoom.Check() {
 		return errors.New("room not ready")
 	}
-	// 调用房间的 Start 方法
-	// 注意：Start 内部应该处理并发调用，确保只能启动一次
-	gameRoom.Start()
-	// 获取匹配信息
-	matchInfo := gameRoom.GetMatchInfo()
-	// 2. 游戏开始之后，要根据游戏最长时间，要自动关闭游戏
-	if matchInfo != nil && matchInfo.MaxGameTime > 0 {
-		// 使用 gocron 调度自动关闭任务
-		// Tag: room-{id}, room-{id}-close
-		s.scheduler.Every(matchInfo.MaxGameTime).Seconds().LimitRunsTo(1).Tag(
-			fmt.Sprintf("room-%d", roomID),
-			fmt.Sprintf("room-%d-close", roomID),
-		).Do(s.CloseRoom, roomID)
+	// 调用房间的 Start 方法，状态机保证只能启动一次，自动关闭任务由 onStateChange 添加
+	return gameRoom.Start()
+}
+
+// startOrClose 等待时间到了仍然没有开始的房间，人数不足时关闭，避免房间一直残留
+func (s *RoomService) startOrClose(roomID int64) {
+	if err := s.StartRoom(roomID); err == nil {
+		return
 	}
-	return nil
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok || gameRoom.GetStatus() != room.RoomStatus_Init {
+		return
+	}
+	log.Printf("Room %d not enough players after wait time, closing", roomID)
+	s.CloseRoom(roomID, room.CloseNotEnoughPlayers)
 }
 
-func (s *RoomService) CloseRoom(roomID int64) error {
+// CloseRoom 关闭房间，reason 会传给房间和结算
+func (s *RoomService) CloseRoom(roomID int64, reason room.CloseReason) error {
 	gameRoom, ok := s.Rooms.Load(roomID)
 	if !ok {
 		return errors.New("room not exist")
 	}
 	// 取消该房间的所有调度任务
-	s.scheduler.RemoveByTag(fmt.Sprintf("room-%d", roomID))
+	s.scheduler.CancelRoom(roomID)
 	s.Rooms.Delete(roomID)
 	// 关闭房间
-	gameRoom.(room.GameRoom).Close()
+	gameRoom.(room.GameRoom).Close(reason)
+	s.removed(roomID, gameRoom.(room.GameRoom).GetMatchInfo())
 	return nil
 }
 
+// PauseRoom 暂停房间，房间的逻辑帧、定时器和自动关闭倒计时都会停止
+func (s *RoomService) PauseRoom(roomID int64) error {
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok {
+		return errors.New("room not exist")
+	}
+	return gameRoom.Pause()
+}
+
+// ResumeRoom 恢复暂停的房间，自动关闭时间顺延暂停的时长
+func (s *RoomService) ResumeRoom(roomID int64) error {
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok {
+		return errors.New("room not exist")
+	}
+	return gameRoom.Resume()
+}
+
+// VotePause 玩家投票暂停，票数达到房间设置的比例时暂停房间
+func (s *RoomService) VotePause(uid int64, roomID int64) error {
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok {
+		return errors.New("room not exist")
+	}
+	r, ok := gameRoom.(interface {
+		VotePause(uid int64) (bool, error)
+	})
+	if !ok {
+		return room.ErrPauseVoteDisabled
+	}
+	passed, err := r.VotePause(uid)
+	if err != nil || !passed {
+		return err
+	}
+	return s.PauseRoom(roomID)
+}
+
+// RoomTimers 房间等待执行的生命周期任务（自动开始、自动关闭等）
+func (s *RoomService) RoomTimers(roomID int64) []scheduler.Entry {
+	return s.scheduler.Entries(roomID)
+}
+
+// CancelRoomTimer 取消房间的生命周期任务，name 如 scheduler.NameStart
+func (s *RoomService) CancelRoomTimer(roomID int64, name string) bool {
+	return s.scheduler.Cancel(scheduler.Key{RoomID: roomID, Name: name})
+}
+
 // Keep DeleteRoom for backward compatibility or alias to CloseRoom
 func (s *RoomService) DeleteRoom(roomID int64) error {
-	return s.CloseRoom(roomID)
+	return s.CloseRoom(roomID, room.CloseAdmin)
 }
 
 func (s *RoomService) UserEnterRoom(uid int64, roomID int64, sess session.Session) error {
@@ -145,6 +458,28 @@ func (s *RoomService) UserEnterRoom(uid int64, roomID int64, sess session.Sessio
 	return nil
 }
 
+// SpectateRoom 以观战者身份进入房间，和 UserEnterRoom 一样会离开之前所在的房间
+func (s *RoomService) SpectateRoom(uid int64, roomID int64, sess session.Session) error {
+	gameRoom, ok := s.GetRoom(roomID)
+	if !ok {
+		return errors.New("room not exist")
+	}
+	if err := gameRoom.SpectatorEnter(uid, sess); err != nil {
+		return err
+	}
+	if oldRoomID, loaded := s.UserRoomMap.Swap(uid, roomID); loaded {
+		if oldID := oldRoomID.(int64); oldID != roomID {
+			if oldRoom, exists := s.GetRoom(oldID); exists {
+				oldRoom.UserLeaveRoom(uid, oldID)
+			}
+		}
+	}
+	if s.kickPublisher != nil {
+		s.kickPublisher(uid)
+	}
+	return nil
+}
+
 func (s *RoomService) UserLeaveRoom(uid int64, roomID int64) error {
 	gameRoom, ok := s.GetRoom(roomID)
 	if !ok {
@@ -161,6 +496,20 @@ func (s *RoomService) UserLeaveRoom(uid int64, roomID int64) error {
 	return nil
 }
 
+// UserDisconnect 连接断开，由房间决定是保留座位等待重连还是直接离开
+func (s *RoomService) UserDisconnect(uid int64, sess session.Session) error {
+	roomID, loaded := s.UserRoomMap.Load(uid)
+	if !loaded {
+		return errors.New("user not in room")
+	}
+	gameRoom, ok := s.GetRoom(roomID.(int64))
+	if !ok {
+		return errors.New("room not exist")
+	}
+	gameRoom.UserDisconnect(uid, sess)
+	return nil
+}
+
 func (s *RoomService) KickUser(uid int64) {
 	// Check if user is in any room on this node
 	if roomID, loaded := s.UserRoomMap.Load(uid); loaded {
@@ -173,3 +522,20 @@ func (s *RoomService) KickUser(uid int64) {
 		s.UserRoomMap.Delete(uid)
 	}
 }
+
+// MailboxStats 各房间 mailbox 的排队统计，用于发现处理不过来的房间
+// 只包含注册到 Actors 的房间（如 RoomActor）
+func (s *RoomService) MailboxStats() map[int64]room.MailboxStats {
+	stats := make(map[int64]room.MailboxStats)
+	s.Actors.Range(room.ActorKind, func(ref actor.Ref) bool {
+		if a, ok := ref.(interface{ MailboxStats() actor.MailboxStats }); ok {
+			stats[ref.ID()] = a.MailboxStats()
+		}
+		return true
+	})
+	return stats
+}
+
+func seconds(n int32) time.Duration {
+	return time.Duration(n) * time.Second
+}
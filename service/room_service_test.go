@@ -0,0 +1,384 @@
+package service_test
+
+import (
+	"game_actor/clock"
+	"game_actor/match"
+	"game_actor/room"
+	"game_actor/scheduler"
+	"game_actor/service"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fixture 房间和调度器共用一个 clock.Fake，生命周期任务在虚拟时间中执行
+type fixture struct {
+	svc     *service.RoomService
+	clock   *clock.Fake
+	removed chan int64
+}
+
+func newFixture(t *testing.T, opts ...room.OptionFunc) *fixture {
+	t.Helper()
+	c := clock.NewFake(epoch)
+	sched := scheduler.New(c)
+	t.Cleanup(sched.Stop)
+	f := &fixture{clock: c, removed: make(chan int64, 4)}
+	builder := func(roomID int64, matchInfo *match.MatchInfo) room.GameRoom {
+		return room.NewRoomActor(roomID, matchInfo, append(opts, room.WithClock(c))...)
+	}
+	f.svc = service.NewRoomService(builder, nil,
+		service.WithClock(c),
+		service.WithScheduler(sched),
+		service.WithRemoveHook(func(roomID int64, matchInfo *match.MatchInfo) {
+			f.removed <- roomID
+		}),
+	)
+	return f
+}
+
+// 对局的玩家，全部进入时房间会立即开始
+var matchPlayers = []int64{100, 200}
+
+// createRoom 创建房间，players 中的玩家以机器人（没有 session）身份进入
+func (f *fixture) createRoom(t *testing.T, roomID int64, wait, game int32, players ...int64) *room.RoomActor {
+	t.Helper()
+	matchInfo := &match.MatchInfo{MaxPlayerWaitTime: wait, MaxGameTime: game}
+	for _, uid := range matchPlayers {
+		matchInfo.Players = append(matchInfo.Players, &match.Player{PlayerUID: uid})
+	}
+	gameRoom, err := f.svc.CreateRoom(roomID, matchInfo)
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	r := gameRoom.(*room.RoomActor)
+	t.Cleanup(func() { r.Close(room.CloseAdmin) })
+	for _, uid := range players {
+		if err := f.svc.UserEnterRoom(uid, roomID, nil); err != nil {
+			t.Fatalf("enter room: %v", err)
+		}
+	}
+	if err := r.Actor().RunPending(); err != nil {
+		t.Fatalf("run pending: %v", err)
+	}
+	return r
+}
+
+// waitStatus 生命周期任务在调度器的 goroutine 中执行，等待房间状态变化
+func waitStatus(t *testing.T, r room.GameRoom, want int32) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for r.GetStatus() != want {
+		if time.Now().After(deadline) {
+			t.Fatalf("room status %d, want %d", r.GetStatus(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func (f *fixture) waitRemoved(t *testing.T, roomID int64) {
+	t.Helper()
+	select {
+	case id := <-f.removed:
+		if id != roomID {
+			t.Fatalf("removed room %d, want %d", id, roomID)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("room %d not removed", roomID)
+	}
+	if _, ok := f.svc.GetRoom(roomID); ok {
+		t.Fatalf("room %d still registered", roomID)
+	}
+}
+
+// remaining 等待房间的生命周期任务出现，返回剩余时间
+// 自动开始时房间先切换状态，之后才添加自动关闭任务
+func (f *fixture) remaining(t *testing.T, roomID int64, name string) time.Duration {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, entry := range f.svc.RoomTimers(roomID) {
+			if entry.Key.Name == name {
+				return entry.Remaining
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("room %d has no %s timer", roomID, name)
+	return 0
+}
+
+// 等待时间到了自动开始，之后超过最长游戏时间自动关闭
+func TestRoomAutoStartAndClose(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60, 100)
+
+	f.clock.Advance(9 * time.Second)
+	if status := r.GetStatus(); status != room.RoomStatus_Init {
+		t.Fatalf("room started before wait time, status %d", status)
+	}
+	f.clock.Advance(time.Second)
+	waitStatus(t, r, room.RoomStatus_Start)
+	if d := f.remaining(t, 1, scheduler.NameClose); d != 60*time.Second {
+		t.Fatalf("close in %v, want 60s", d)
+	}
+
+	f.clock.Advance(59 * time.Second)
+	if status := r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room closed before max game time, status %d", status)
+	}
+	f.clock.Advance(time.Second)
+	f.waitRemoved(t, 1)
+	waitStatus(t, r, room.RoomStatus_Close)
+}
+
+// 等待时间到了人数仍然不足，房间关闭
+func TestRoomAutoCloseNotEnoughPlayers(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60)
+
+	f.clock.Advance(10 * time.Second)
+	f.waitRemoved(t, 1)
+	waitStatus(t, r, room.RoomStatus_Close)
+	if timers := f.svc.RoomTimers(1); len(timers) != 0 {
+		t.Fatalf("timers left after close: %+v", timers)
+	}
+}
+
+// 手动开始后取消自动开始，暂停期间自动关闭倒计时停止
+func TestRoomPauseDelaysAutoClose(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60, 100)
+	if err := f.svc.StartRoom(1); err != nil {
+		t.Fatalf("start room: %v", err)
+	}
+	f.clock.Advance(10 * time.Second)
+	if timers := f.svc.RoomTimers(1); len(timers) != 1 || timers[0].Key.Name != scheduler.NameClose {
+		t.Fatalf("unexpected timers after manual start: %+v", timers)
+	}
+
+	f.clock.Advance(20 * time.Second)
+	if err := f.svc.PauseRoom(1); err != nil {
+		t.Fatalf("pause room: %v", err)
+	}
+	f.clock.Advance(10 * time.Minute)
+	if d := f.remaining(t, 1, scheduler.NameClose); d != 30*time.Second {
+		t.Fatalf("close in %v after pause, want 30s", d)
+	}
+	if err := f.svc.ResumeRoom(1); err != nil {
+		t.Fatalf("resume room: %v", err)
+	}
+
+	f.clock.Advance(29 * time.Second)
+	if status := r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room closed early, status %d", status)
+	}
+	f.clock.Advance(time.Second)
+	f.waitRemoved(t, 1)
+}
+
+// 玩家全部进入后房间在 actor 中自动开始，同样添加自动关闭任务
+func TestRoomAllPlayersEnteredClose(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60, matchPlayers...)
+	if status := r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room status %d after all players entered, want started", status)
+	}
+	if timers := f.svc.RoomTimers(1); len(timers) != 1 || timers[0].Key.Name != scheduler.NameClose {
+		t.Fatalf("unexpected timers after auto start: %+v", timers)
+	}
+	f.clock.Advance(60 * time.Second)
+	f.waitRemoved(t, 1)
+}
+
+// 直接调用房间的 Pause/Resume（如游戏逻辑中）同样暂停自动关闭倒计时
+func TestRoomDirectPauseDelaysAutoClose(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60, 100)
+	if err := r.Start(); err != nil {
+		t.Fatalf("start room: %v", err)
+	}
+	f.clock.Advance(20 * time.Second)
+	if err := r.Pause(); err != nil {
+		t.Fatalf("pause room: %v", err)
+	}
+	f.clock.Advance(10 * time.Minute)
+	if err := r.Resume(); err != nil {
+		t.Fatalf("resume room: %v", err)
+	}
+	if d := f.remaining(t, 1, scheduler.NameClose); d != 40*time.Second {
+		t.Fatalf("close in %v after resume, want 40s", d)
+	}
+	f.clock.Advance(40 * time.Second)
+	f.waitRemoved(t, 1)
+}
+
+// 离开房间的玩家的暂停投票不再计入
+func TestPauseVoteClearedOnLeave(t *testing.T) {
+	f := newFixture(t, room.WithPauseVote(1))
+	r := f.createRoom(t, 1, 0, 0, matchPlayers...)
+	if err := f.svc.VotePause(100, 1); err != nil {
+		t.Fatalf("vote pause: %v", err)
+	}
+	if err := f.svc.UserLeaveRoom(100, 1); err != nil {
+		t.Fatalf("leave room: %v", err)
+	}
+	f.svc.UserEnterRoom(100, 1, nil)
+	if err := f.svc.VotePause(200, 1); err != nil {
+		t.Fatalf("vote pause: %v", err)
+	}
+	if status := r.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("room status %d, want still running", status)
+	}
+	if err := f.svc.VotePause(100, 1); err != nil {
+		t.Fatalf("vote pause: %v", err)
+	}
+	if status := r.GetStatus(); status != room.RoomStatus_Paused {
+		t.Fatalf("room status %d after all votes, want paused", status)
+	}
+}
+
+// 恢复暂停中的房间，自动关闭时间顺延快照前暂停的时长，节点停机期间不计入游戏时间
+func TestRestorePausedRoom(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 10, 60, 100)
+	if err := f.svc.StartRoom(1); err != nil {
+		t.Fatalf("start room: %v", err)
+	}
+	f.clock.Advance(10 * time.Second)
+	f.svc.PauseRoom(1)
+	f.clock.Advance(30 * time.Second)
+	f.svc.ResumeRoom(1)
+	f.clock.Advance(20 * time.Second)
+	f.svc.PauseRoom(1)
+	f.clock.Advance(5 * time.Second)
+	snap, err := r.TakeSnapshot()
+	if err != nil {
+		t.Fatalf("take snapshot: %v", err)
+	}
+	if snap.Paused != 35*time.Second {
+		t.Fatalf("snapshot paused %v, want 35s", snap.Paused)
+	}
+
+	// 节点停机 10 分钟后在新的 RoomService 中恢复
+	f2 := newFixture(t)
+	f2.clock.Set(f.clock.Now().Add(10 * time.Minute))
+	if err := f2.svc.RestoreRoom(snap); err != nil {
+		t.Fatalf("restore room: %v", err)
+	}
+	restored, _ := f2.svc.GetRoom(1)
+	t.Cleanup(func() { restored.Close(room.CloseAdmin) })
+	if d := f2.remaining(t, 1, scheduler.NameClose); d != 30*time.Second {
+		t.Fatalf("close in %v after restore, want 30s", d)
+	}
+	if err := f2.svc.ResumeRoom(1); err != nil {
+		t.Fatalf("resume room: %v", err)
+	}
+	f2.clock.Advance(29 * time.Second)
+	if status := restored.GetStatus(); status != room.RoomStatus_Start {
+		t.Fatalf("restored room closed early, status %d", status)
+	}
+	f2.clock.Advance(time.Second)
+	f2.waitRemoved(t, 1)
+}
+
+type testSession struct {
+	uid int64
+}
+
+func (s *testSession) ID() string            { return "test" }
+func (s *testSession) UserID() int64         { return s.uid }
+func (s *testSession) SetUserID(uid int64)   { s.uid = uid }
+func (s *testSession) Send(msg []byte) error { return nil }
+func (s *testSession) Close() error          { return nil }
+
+func (f *fixture) userRoom(uid int64) (int64, bool) {
+	roomID, ok := f.svc.UserRoomMap.Load(uid)
+	if !ok {
+		return 0, false
+	}
+	return roomID.(int64), true
+}
+
+// 房间自己移除的用户（断线没有保留期、保留期结束）从 UserRoomMap 中删除
+func TestUserRoomMapCleanup(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 0, 0)
+	sessions := map[int64]*testSession{100: {uid: 100}, 200: {uid: 200}}
+	for uid, sess := range sessions {
+		if err := f.svc.UserEnterRoom(uid, 1, sess); err != nil {
+			t.Fatalf("enter room: %v", err)
+		}
+	}
+	r.Actor().RunPending()
+
+	// 没有保留期，断线直接离开
+	if err := f.svc.UserDisconnect(100, sessions[100]); err != nil {
+		t.Fatalf("disconnect: %v", err)
+	}
+	r.Actor().RunPending()
+	if _, ok := f.userRoom(100); ok {
+		t.Fatal("user 100 still mapped after leaving on disconnect")
+	}
+
+	// 保留期结束仍未重连
+	f2 := newFixture(t)
+	matchInfo := &match.MatchInfo{ReconnectGraceTime: 10, Players: []*match.Player{{PlayerUID: 100}, {PlayerUID: 200}}}
+	gameRoom, err := f2.svc.CreateRoom(2, matchInfo)
+	if err != nil {
+		t.Fatalf("create room: %v", err)
+	}
+	r2 := gameRoom.(*room.RoomActor)
+	t.Cleanup(func() { r2.Close(room.CloseAdmin) })
+	f2.svc.UserEnterRoom(100, 2, sessions[100])
+	r2.Actor().RunPending()
+	f2.svc.UserDisconnect(100, sessions[100])
+	r2.Actor().RunPending()
+	if roomID, ok := f2.userRoom(100); !ok || roomID != 2 {
+		t.Fatal("user 100 unmapped during reconnect grace")
+	}
+	f2.clock.Advance(10 * time.Second)
+	r2.Actor().RunPending()
+	if _, ok := f2.userRoom(100); ok {
+		t.Fatal("user 100 still mapped after reconnect grace")
+	}
+}
+
+// 离开旧房间的通知晚于进入新房间时，不会删除新房间的记录
+func TestUserRoomMapSwitchRoom(t *testing.T) {
+	f := newFixture(t)
+	r1 := f.createRoom(t, 1, 0, 0)
+	r2 := f.createRoom(t, 2, 0, 0)
+	sess := &testSession{uid: 100}
+	f.svc.UserEnterRoom(100, 1, sess)
+	f.svc.UserEnterRoom(100, 2, sess)
+	r2.Actor().RunPending()
+	r1.Actor().RunPending()
+	if roomID, ok := f.userRoom(100); !ok || roomID != 2 {
+		t.Fatalf("user mapped to %d, want 2", roomID)
+	}
+}
+
+// 房间的 actor 注册到 Actors，房间关闭、actor 停止后自动注销
+func TestRoomActorRegistry(t *testing.T) {
+	f := newFixture(t)
+	r := f.createRoom(t, 1, 0, 0)
+	if ref, ok := f.svc.Actors.Get(room.ActorKind, 1); !ok || ref != r.Actor() {
+		t.Fatal("room actor not registered")
+	}
+	if _, ok := f.svc.MailboxStats()[1]; !ok {
+		t.Fatal("no mailbox stats for room")
+	}
+	f.svc.CloseRoom(1, room.CloseAdmin)
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := f.svc.Actors.Get(room.ActorKind, 1); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("room actor still registered after close")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,101 @@
+package settle
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Deduper 按 MatchID 去重，Add 第一次添加时返回 true
+type Deduper interface {
+	Add(ctx context.Context, matchID int64) (bool, error)
+	// Remove 撤销 Add，结果没有被接受时调用，之后可以重新提交
+	Remove(ctx context.Context, matchID int64) error
+}
+
+// MemoryDeduper 进程内去重，只能防止同一个节点重复提交
+type MemoryDeduper struct {
+	mu   sync.Mutex
+	ttl  time.Duration
+	seen map[int64]time.Time
+	// 按添加顺序保存，用于清理过期的 MatchID
+	order []dedupeEntry
+}
+
+// dedupeEntry Remove 之后重新 Add 的 MatchID 在 order 中有多条记录，expire 和 seen 中不一致的是旧记录
+type dedupeEntry struct {
+	matchID int64
+	expire  time.Time
+}
+
+// NewMemoryDeduper ttl 之后同一个 MatchID 可以再次提交
+func NewMemoryDeduper(ttl time.Duration) *MemoryDeduper {
+	return &MemoryDeduper{
+		ttl:  ttl,
+		seen: make(map[int64]time.Time),
+	}
+}
+
+func (d *MemoryDeduper) Add(ctx context.Context, matchID int64) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	// ttl 固定，order 中的过期时间是递增的
+	for len(d.order) > 0 {
+		e := d.order[0]
+		expire, ok := d.seen[e.matchID]
+		if ok && expire.Equal(e.expire) {
+			if expire.After(now) {
+				break
+			}
+			delete(d.seen, e.matchID)
+		}
+		d.order = d.order[1:]
+	}
+	if _, ok := d.seen[matchID]; ok {
+		return false, nil
+	}
+	expire := now.Add(d.ttl)
+	d.seen[matchID] = expire
+	d.order = append(d.order, dedupeEntry{matchID: matchID, expire: expire})
+	return true, nil
+}
+
+// Remove order 中的记录在清理时跳过
+func (d *MemoryDeduper) Remove(ctx context.Context, matchID int64) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.seen, matchID)
+	return nil
+}
+
+// RedisDeduper 使用 SETNX 去重，多个节点共享
+type RedisDeduper struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+}
+
+// NewRedisDeduper key 为 prefix + MatchID，ttl 之后过期
+func NewRedisDeduper(client *redis.Client, prefix string, ttl time.Duration) *RedisDeduper {
+	return &RedisDeduper{
+		client: client,
+		prefix: prefix,
+		ttl:    ttl,
+	}
+}
+
+func (d *RedisDeduper) key(matchID int64) string {
+	return fmt.Sprintf("%s%d", d.prefix, matchID)
+}
+
+func (d *RedisDeduper) Add(ctx context.Context, matchID int64) (bool, error) {
+	return d.client.SetNX(ctx, d.key(matchID), 1, d.ttl).Result()
+}
+
+func (d *RedisDeduper) Remove(ctx context.Context, matchID int64) error {
+	return d.client.Del(ctx, d.key(matchID)).Err()
+}
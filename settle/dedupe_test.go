@@ -0,0 +1,38 @@
+package settle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// Remove 之后重新添加的 MatchID 不会挡住后面过期记录的清理
+func TestMemoryDeduperRemove(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDeduper(100 * time.Millisecond)
+	for _, id := range []int64{2, 1, 4} {
+		d.Add(ctx, id)
+	}
+	if err := d.Remove(ctx, 1); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if first, _ := d.Add(ctx, 1); !first {
+		t.Fatal("add after remove returned duplicate")
+	}
+	if first, _ := d.Add(ctx, 1); first {
+		t.Fatal("add twice returned first")
+	}
+
+	// 2 和 4 已经过期，1 重新添加后还没有过期
+	time.Sleep(60 * time.Millisecond)
+	d.Add(ctx, 3)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.seen[4]; ok || len(d.seen) != 2 {
+		t.Fatalf("seen %v after sweep, want 1 and 3", d.seen)
+	}
+	if len(d.order) != 2 {
+		t.Fatalf("%d order entries after sweep, want 2", len(d.order))
+	}
+}
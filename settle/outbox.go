@@ -0,0 +1,93 @@
+package settle
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Outbox 保存已经接受但还没有投递完的结果，节点重启后由 Settler.Recover 继续投递
+// Submit 在返回前写入，所有 Sink 投递完成（成功或重试用尽）后删除
+type Outbox interface {
+	Put(ctx context.Context, r *Result) error
+	Delete(ctx context.Context, matchID int64) error
+	List(ctx context.Context) ([]*Result, error)
+}
+
+const outboxExt = ".json"
+
+// FileOutbox 每个结果一个 JSON 文件，先写临时文件再 rename，崩溃时不会留下写了一半的结果
+type FileOutbox struct {
+	dir string
+}
+
+// NewFileOutbox dir 不存在时自动创建，每个节点应使用自己的目录
+func NewFileOutbox(dir string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileOutbox{dir: dir}, nil
+}
+
+func (o *FileOutbox) path(matchID int64) string {
+	return filepath.Join(o.dir, strconv.FormatInt(matchID, 10)+outboxExt)
+}
+
+func (o *FileOutbox) Put(ctx context.Context, r *Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(o.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), o.path(r.MatchID))
+}
+
+func (o *FileOutbox) Delete(ctx context.Context, matchID int64) error {
+	err := os.Remove(o.path(matchID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (o *FileOutbox) List(ctx context.Context) ([]*Result, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, err
+	}
+	var results []*Result
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), outboxExt) {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(o.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		r := new(Result)
+		if err := json.Unmarshal(body, r); err != nil {
+			return nil, err
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
@@ -0,0 +1,54 @@
+// Package settle 对局结算：游戏逻辑提交结构化的对局结果，由 Settler 投递到一个或多个 Sink
+// 同一个 MatchID 只会被提交一次，投递失败时重试，接收方需要按 MatchID 去重
+// 设置 WithOutbox 时投递至少一次：结果在 Submit 返回前持久化，进程崩溃后通过 Settler.Recover 继续投递
+// 不设置 Outbox 时只在进程内重试，进程退出时还没投递完的结果会丢失
+package settle
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Reason 对局结束原因
+type Reason string
+
+const (
+	// 正常结束
+	ReasonNormal Reason = "normal"
+	// 超过最长游戏时间
+	ReasonTimeout Reason = "timeout"
+	// 玩家全部离开或人数不足，对局作废
+	ReasonAbandon Reason = "abandon"
+	// 房间 panic 等异常关闭
+	ReasonCrash Reason = "crash"
+)
+
+// Outcome 玩家的对局结果
+type Outcome string
+
+const (
+	OutcomeWin  Outcome = "win"
+	OutcomeLose Outcome = "lose"
+	OutcomeDraw Outcome = "draw"
+	// 没有胜负，如对局作废
+	OutcomeNone Outcome = "none"
+)
+
+type PlayerResult struct {
+	UID     int64   `json:"uid"`
+	Camp    int32   `json:"camp"`
+	Score   int64   `json:"score"`
+	Outcome Outcome `json:"outcome"`
+}
+
+// Result 对局结果，提交后不能再修改
+type Result struct {
+	MatchID int64           `json:"match_id"`
+	GameID  int64           `json:"game_id"`
+	RoomID  int64           `json:"room_id"`
+	Reason  Reason          `json:"reason"`
+	Players []*PlayerResult `json:"players"`
+	// 游戏自定义数据，原样投递
+	Extra json.RawMessage `json:"extra,omitempty"`
+	EndAt time.Time       `json:"end_at"`
+}
@@ -0,0 +1,337 @@
+package settle
+
+import (
+	"context"
+	"errors"
+	"game_actor/clock"
+	"log"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDuplicate = errors.New("result already submitted")
+	ErrNoMatchID = errors.New("result without match id")
+	ErrClosed    = errors.New("settler closed")
+)
+
+type Options struct {
+	sinks   []Sink
+	deduper Deduper
+	outbox  Outbox
+	// 每个 Sink 最多尝试的次数，0 表示一直重试直到 Close
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	// 单次投递的超时，也用于 Submit 中的去重和写入 Outbox
+	timeout   time.Duration
+	onFailure func(sink string, r *Result, err error)
+	clock     clock.Clock
+}
+
+type OptionFunc func(*Options)
+
+// WithSink 添加投递目标，结果会投递到所有 Sink，各 Sink 独立重试
+func WithSink(sink Sink) OptionFunc {
+	return func(o *Options) {
+		o.sinks = append(o.sinks, sink)
+	}
+}
+
+// WithDeduper 替换 MatchID 去重，多节点部署时使用 RedisDeduper
+func WithDeduper(d Deduper) OptionFunc {
+	return func(o *Options) {
+		o.deduper = d
+	}
+}
+
+// WithOutbox Submit 返回前把结果写入 Outbox，进程崩溃或 Close 超时没有投递完的结果，重启后通过 Recover 继续投递
+// 不设置时结果只保存在内存中，进程退出时还没投递完的结果会丢失
+func WithOutbox(outbox Outbox) OptionFunc {
+	return func(o *Options) {
+		o.outbox = outbox
+	}
+}
+
+// WithRetry 设置重试次数和退避时间，每次失败后等待时间翻倍，不超过 maxBackoff
+func WithRetry(maxAttempts int, backoff, maxBackoff time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.maxAttempts = maxAttempts
+		o.backoff = backoff
+		o.maxBackoff = maxBackoff
+	}
+}
+
+// WithTimeout 设置单次投递的超时，SubmitAsync 和没有 deadline 的 Submit 也使用这个超时
+func WithTimeout(d time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.timeout = d
+	}
+}
+
+// WithFailureHandler 某个 Sink 重试用尽或 Settler 关闭时仍未投递成功，可以在这里写入兜底存储
+func WithFailureHandler(h func(sink string, r *Result, err error)) OptionFunc {
+	return func(o *Options) {
+		o.onFailure = h
+	}
+}
+
+// WithClock 设置重试等待使用的时钟，测试中可以使用 clock.Fake
+func WithClock(c clock.Clock) OptionFunc {
+	return func(o *Options) {
+		o.clock = c
+	}
+}
+
+// Settler 结算管道，Submit 之后在后台投递到所有 Sink
+type Settler struct {
+	option *Options
+	wg     sync.WaitGroup
+	// 保护 closed 和 wg.Add，避免 Close 等待时再添加投递
+	mu     sync.Mutex
+	closed bool
+	// Close 超时后关闭，正在重试的投递放弃
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func New(opts ...OptionFunc) *Settler {
+	opt := &Options{
+		backoff:    time.Second,
+		maxBackoff: time.Minute,
+		timeout:    10 * time.Second,
+		clock:      clock.Real,
+	}
+	for _, o := range opts {
+		o(opt)
+	}
+	if opt.deduper == nil {
+		opt.deduper = NewMemoryDeduper(24 * time.Hour)
+	}
+	return &Settler{
+		option: opt,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Submit 提交对局结果，同一个 MatchID 重复提交返回 ErrDuplicate
+// 返回 nil 只表示已经接受（设置了 Outbox 时已经持久化），投递在后台进行
+// 去重和写入 Outbox 可能访问 Redis 或磁盘，不能阻塞的调用方（如房间的 actor goroutine）使用 SubmitAsync
+func (s *Settler) Submit(ctx context.Context, r *Result) error {
+	if r.MatchID == 0 {
+		return ErrNoMatchID
+	}
+	if s.isClosed() {
+		return ErrClosed
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.option.timeout)
+		defer cancel()
+	}
+	return s.accept(ctx, r, false)
+}
+
+// SubmitAsync 在后台执行 Submit，done 在提交结束后以 Submit 的返回值调用（可以为 nil）
+// 已经关闭时返回 ErrClosed；Close 会等待已经开始的提交，这些结果不会因为关闭而丢失
+func (s *Settler) SubmitAsync(r *Result, done func(err error)) error {
+	if r.MatchID == 0 {
+		return ErrNoMatchID
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrClosed
+	}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	go func() {
+		defer s.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), s.option.timeout)
+		defer cancel()
+		err := s.accept(ctx, r, true)
+		if done != nil {
+			done(err)
+		}
+	}()
+	return nil
+}
+
+// accept 去重、写入 Outbox 后开始投递，pinned 为 true 时已经占用了 wg，Close 期间也可以开始投递
+func (s *Settler) accept(ctx context.Context, r *Result, pinned bool) error {
+	first, err := s.option.deduper.Add(ctx, r.MatchID)
+	if err != nil {
+		return err
+	}
+	if !first {
+		return ErrDuplicate
+	}
+	outbox := s.option.outbox != nil && len(s.option.sinks) > 0
+	if outbox {
+		if err := s.option.outbox.Put(ctx, r); err != nil {
+			s.reject(ctx, r, false)
+			return err
+		}
+	}
+	// 去重期间 Close 了，撤销标记，结果没有被接受
+	if !s.start(r, pinned) {
+		s.reject(ctx, r, outbox)
+		return ErrClosed
+	}
+	return nil
+}
+
+// Recover 继续投递 Outbox 中上次没有投递完的结果，节点启动后、房间恢复前调用一次
+// 返回恢复的结果数量，没有设置 Outbox 时什么也不做
+func (s *Settler) Recover(ctx context.Context) (int, error) {
+	if s.option.outbox == nil {
+		return 0, nil
+	}
+	results, err := s.option.outbox.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	for i, r := range results {
+		// 重启后 MemoryDeduper 是空的，重新标记，避免恢复的房间再次提交
+		if _, err := s.option.deduper.Add(ctx, r.MatchID); err != nil {
+			return i, err
+		}
+		if !s.start(r, false) {
+			return i, ErrClosed
+		}
+	}
+	return len(results), nil
+}
+
+func (s *Settler) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// start 在后台投递到所有 Sink，已经关闭时返回 false（pinned 见 accept）
+func (s *Settler) start(r *Result, pinned bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed && !pinned {
+		return false
+	}
+	d := &delivery{r: r, pending: len(s.option.sinks)}
+	for _, sink := range s.option.sinks {
+		s.wg.Add(1)
+		go s.deliver(sink, d)
+	}
+	return true
+}
+
+// reject 结果没有被接受，撤销去重标记和已经写入的 Outbox
+func (s *Settler) reject(ctx context.Context, r *Result, outbox bool) {
+	if outbox {
+		if err := s.option.outbox.Delete(ctx, r.MatchID); err != nil {
+			log.Printf("Settle match %d remove from outbox error: %v", r.MatchID, err)
+		}
+	}
+	if err := s.option.deduper.Remove(ctx, r.MatchID); err != nil {
+		log.Printf("Settle match %d remove dedupe mark error: %v", r.MatchID, err)
+	}
+}
+
+// Close 不再接受新的结果，等待正在投递的结果完成
+// ctx 结束时放弃剩余的投递并通过 WithFailureHandler 通知，返回 ctx.Err()
+// 放弃的结果仍保留在 Outbox 中，重启后 Recover 继续投递
+func (s *Settler) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.stopOnce.Do(func() { close(s.stop) })
+		<-done
+		return ctx.Err()
+	}
+}
+
+// delivery 一个结果到所有 Sink 的投递，全部结束后从 Outbox 删除
+type delivery struct {
+	r       *Result
+	mu      sync.Mutex
+	pending int
+	// Close 超时放弃了投递，保留在 Outbox 中
+	abandoned bool
+}
+
+func (s *Settler) deliver(sink Sink, d *delivery) {
+	defer s.wg.Done()
+	r := d.r
+	backoff := s.option.backoff
+	for attempt := 1; ; attempt++ {
+		err := s.attempt(sink, r)
+		if err == nil {
+			s.finish(d, false)
+			return
+		}
+		if s.option.maxAttempts > 0 && attempt >= s.option.maxAttempts {
+			s.fail(sink, r, err)
+			s.finish(d, false)
+			return
+		}
+		log.Printf("Settle match %d to %s failed (attempt %d): %v", r.MatchID, sink.Name(), attempt, err)
+
+		timer := s.option.clock.NewTimer(backoff)
+		select {
+		case <-timer.C():
+		case <-s.stop:
+			timer.Stop()
+			s.fail(sink, r, ErrClosed)
+			s.finish(d, true)
+			return
+		}
+		backoff = min(backoff*2, s.option.maxBackoff)
+	}
+}
+
+// finish 一个 Sink 的投递结束，成功或重试用尽都算结束
+func (s *Settler) finish(d *delivery, abandoned bool) {
+	d.mu.Lock()
+	d.pending--
+	d.abandoned = d.abandoned || abandoned
+	done := d.pending == 0 && !d.abandoned
+	d.mu.Unlock()
+	if !done || s.option.outbox == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.option.timeout)
+	defer cancel()
+	if err := s.option.outbox.Delete(ctx, d.r.MatchID); err != nil {
+		log.Printf("Settle match %d remove from outbox error: %v", d.r.MatchID, err)
+	}
+}
+
+func (s *Settler) attempt(sink Sink, r *Result) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.option.timeout)
+	defer cancel()
+	// Sink 的 panic 按投递失败处理
+	defer func() {
+		if v := recover(); v != nil {
+			err = errors.New("settle sink panic")
+			log.Printf("Settle sink %s panic: %v", sink.Name(), v)
+		}
+	}()
+	return sink.Deliver(ctx, r)
+}
+
+func (s *Settler) fail(sink Sink, r *Result, err error) {
+	if s.option.onFailure == nil {
+		log.Printf("Settle match %d to %s gave up: %v", r.MatchID, sink.Name(), err)
+		return
+	}
+	s.option.onFailure(sink.Name(), r, err)
+}
@@ -0,0 +1,189 @@
+package settle_test
+
+import (
+	"context"
+	"errors"
+	"game_actor/clock"
+	"game_actor/settle"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testSink 前 failures 次投递失败，成功投递的 MatchID 写入 delivered
+type testSink struct {
+	failures  int
+	attempts  chan int64
+	delivered chan int64
+}
+
+func newTestSink(failures int) *testSink {
+	return &testSink{failures: failures, attempts: make(chan int64, 16), delivered: make(chan int64, 16)}
+}
+
+func (s *testSink) Name() string { return "test" }
+
+// Deliver 只在 Settler 的投递 goroutine 中调用，同一个结果的重试是串行的
+func (s *testSink) Deliver(ctx context.Context, r *settle.Result) error {
+	s.attempts <- r.MatchID
+	if s.failures != 0 {
+		s.failures--
+		return errors.New("sink unavailable")
+	}
+	s.delivered <- r.MatchID
+	return nil
+}
+
+func receive(t *testing.T, ch chan int64, want int64) {
+	t.Helper()
+	select {
+	case got := <-ch:
+		if got != want {
+			t.Fatalf("got match %d, want %d", got, want)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for match %d", want)
+	}
+}
+
+// waitTimer 等待投递 goroutine 开始退避等待
+func waitTimer(t *testing.T, c *clock.Fake) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for c.Pending() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no retry timer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func closeSettler(t *testing.T, s *settle.Settler) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := s.Close(ctx); err != nil {
+		t.Fatalf("close settler: %v", err)
+	}
+}
+
+func TestSettlerDuplicate(t *testing.T) {
+	sink := newTestSink(0)
+	s := settle.New(settle.WithSink(sink))
+	if err := s.Submit(context.Background(), &settle.Result{}); !errors.Is(err, settle.ErrNoMatchID) {
+		t.Fatalf("submit without match id: got %v, want ErrNoMatchID", err)
+	}
+	if err := s.Submit(context.Background(), &settle.Result{MatchID: 1}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	if err := s.Submit(context.Background(), &settle.Result{MatchID: 1}); !errors.Is(err, settle.ErrDuplicate) {
+		t.Fatalf("submit twice: got %v, want ErrDuplicate", err)
+	}
+	receive(t, sink.delivered, 1)
+	closeSettler(t, s)
+	if err := s.Submit(context.Background(), &settle.Result{MatchID: 2}); !errors.Is(err, settle.ErrClosed) {
+		t.Fatalf("submit after close: got %v, want ErrClosed", err)
+	}
+}
+
+// 投递失败后按退避时间重试，每次等待翻倍
+func TestSettlerRetry(t *testing.T) {
+	c := clock.NewFake(epoch)
+	sink := newTestSink(2)
+	s := settle.New(settle.WithSink(sink), settle.WithClock(c), settle.WithRetry(5, time.Second, time.Minute))
+	if err := s.Submit(context.Background(), &settle.Result{MatchID: 1}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	receive(t, sink.attempts, 1)
+	waitTimer(t, c)
+	c.Advance(time.Second)
+	receive(t, sink.attempts, 1)
+
+	waitTimer(t, c)
+	c.Advance(time.Second)
+	select {
+	case <-sink.attempts:
+		t.Fatal("retried before doubled backoff")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Advance(time.Second)
+	receive(t, sink.attempts, 1)
+	receive(t, sink.delivered, 1)
+	closeSettler(t, s)
+}
+
+// 重试用尽后通知 WithFailureHandler
+func TestSettlerGiveUp(t *testing.T) {
+	c := clock.NewFake(epoch)
+	failed := make(chan int64, 1)
+	s := settle.New(
+		settle.WithSink(newTestSink(-1)),
+		settle.WithClock(c),
+		settle.WithRetry(2, time.Second, time.Minute),
+		settle.WithFailureHandler(func(sink string, r *settle.Result, err error) {
+			failed <- r.MatchID
+		}),
+	)
+	s.Submit(context.Background(), &settle.Result{MatchID: 1})
+	waitTimer(t, c)
+	c.Advance(time.Second)
+	receive(t, failed, 1)
+	closeSettler(t, s)
+}
+
+// Close 等待 SubmitAsync 已经开始的提交，结果不会因为关闭而丢失
+func TestSettlerSubmitAsyncClose(t *testing.T) {
+	sink := newTestSink(0)
+	s := settle.New(settle.WithSink(sink))
+	done := make(chan error, 1)
+	if err := s.SubmitAsync(&settle.Result{MatchID: 1}, func(err error) { done <- err }); err != nil {
+		t.Fatalf("submit async: %v", err)
+	}
+	closeSettler(t, s)
+	if err := <-done; err != nil {
+		t.Fatalf("async submit: %v", err)
+	}
+	receive(t, sink.delivered, 1)
+	if err := s.SubmitAsync(&settle.Result{MatchID: 2}, nil); !errors.Is(err, settle.ErrClosed) {
+		t.Fatalf("submit async after close: got %v, want ErrClosed", err)
+	}
+}
+
+// Close 超时放弃的结果保留在 Outbox 中，重启后 Recover 继续投递，恢复的 MatchID 不能再次提交
+func TestSettlerRecover(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := settle.NewFileOutbox(dir)
+	if err != nil {
+		t.Fatalf("new outbox: %v", err)
+	}
+	c := clock.NewFake(epoch)
+	down := newTestSink(-1)
+	s := settle.New(settle.WithSink(down), settle.WithOutbox(outbox), settle.WithClock(c))
+	if err := s.Submit(context.Background(), &settle.Result{MatchID: 1, RoomID: 7}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	waitTimer(t, c)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Close(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("close: got %v, want context.Canceled", err)
+	}
+
+	// 重启后使用新的 Settler 和同一个目录
+	outbox, _ = settle.NewFileOutbox(dir)
+	sink := newTestSink(0)
+	s2 := settle.New(settle.WithSink(sink), settle.WithOutbox(outbox))
+	n, err := s2.Recover(context.Background())
+	if err != nil || n != 1 {
+		t.Fatalf("recover: %d results, %v; want 1", n, err)
+	}
+	receive(t, sink.delivered, 1)
+	if err := s2.Submit(context.Background(), &settle.Result{MatchID: 1}); !errors.Is(err, settle.ErrDuplicate) {
+		t.Fatalf("submit recovered match: got %v, want ErrDuplicate", err)
+	}
+	closeSettler(t, s2)
+	if results, err := outbox.List(context.Background()); err != nil || len(results) != 0 {
+		t.Fatalf("outbox after delivery: %d results, %v; want empty", len(results), err)
+	}
+}
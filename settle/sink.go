@@ -0,0 +1,143 @@
+package settle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Sink 结算结果的投递目标，返回错误时 Settler 会重试
+// 重试可能导致同一个结果被投递多次，接收方需要按 MatchID 去重
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, r *Result) error
+}
+
+// HTTPSink 以 JSON POST 到回调地址，2xx 表示成功
+// 请求头 Idempotency-Key 为 MatchID，方便接收方去重
+type HTTPSink struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPSink client 为空时使用 http.DefaultClient，超时由 Settler 控制
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &HTTPSink{
+		url:    url,
+		client: client,
+	}
+}
+
+func (s *HTTPSink) Name() string {
+	return "http"
+}
+
+func (s *HTTPSink) Deliver(ctx context.Context, r *Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", strconv.FormatInt(r.MatchID, 10))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("settle http callback: %s", resp.Status)
+	}
+	return nil
+}
+
+// RedisStreamSink 使用 XADD 写入 Redis Stream，字段为 match_id 和 result(JSON)
+type RedisStreamSink struct {
+	client *redis.Client
+	stream string
+	// 大于 0 时近似裁剪 stream 长度
+	maxLen int64
+}
+
+func NewRedisStreamSink(client *redis.Client, stream string, maxLen int64) *RedisStreamSink {
+	return &RedisStreamSink{
+		client: client,
+		stream: stream,
+		maxLen: maxLen,
+	}
+}
+
+func (s *RedisStreamSink) Name() string {
+	return "redis:" + s.stream
+}
+
+func (s *RedisStreamSink) Deliver(ctx context.Context, r *Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: s.stream,
+		MaxLen: s.maxLen,
+		Approx: s.maxLen > 0,
+		Values: map[string]any{
+			"match_id": r.MatchID,
+			"result":   body,
+		},
+	}).Err()
+}
+
+// FileSink 以 JSON Lines 追加写入本地文件，每条结果写入后 fsync
+// 可以单独使用，也可以作为其他 Sink 投递失败时的兜底
+type FileSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{
+		path: path,
+		file: file,
+	}, nil
+}
+
+func (s *FileSink) Name() string {
+	return "file:" + s.path
+}
+
+func (s *FileSink) Deliver(ctx context.Context, r *Result) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.file.Write(append(body, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
@@ -0,0 +1,38 @@
+// Package snapshot 房间状态快照，用于节点崩溃后恢复房间
+//
+// 房间在 actor 中生成快照（见 room.WithSnapshot），保存到 Store；
+// 节点重启后通过 RoomService.RestoreRooms 从 Store 中恢复房间，玩家重新连接即可继续游戏
+package snapshot
+
+import (
+	"errors"
+	"game_actor/match"
+	"game_actor/settle"
+	"time"
+)
+
+var ErrNotFound = errors.New("snapshot not found")
+
+// Snapshot 房间在某一时刻的状态
+type Snapshot struct {
+	RoomID    int64            `json:"room_id"`
+	MatchInfo *match.MatchInfo `json:"match_info"`
+	Status    int32            `json:"status"`
+	// 快照时在房间内的对局玩家，不包括观战者和非对局用户
+	Players []int64 `json:"players"`
+	// 当前逻辑帧号，恢复后继续递增
+	Frame uint64 `json:"frame,omitempty"`
+	// 游戏逻辑已经设置的对局结果
+	Result  *settle.Result `json:"result,omitempty"`
+	Settled bool           `json:"settled,omitempty"`
+	// 房间创建和开始游戏的时间，恢复时用于计算剩余的等待时间和游戏时间
+	CreatedAt time.Time `json:"created_at"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+	// 开始游戏后累计暂停的时长（包括快照时还没有结束的暂停），恢复时自动关闭时间顺延这段时长
+	Paused time.Duration `json:"paused,omitempty"`
+	// 游戏自定义状态，由 room.Snapshotter 生成
+	Data []byte `json:"data,omitempty"`
+	// 房间内递增的序号，越大越新
+	Seq uint64    `json:"seq"`
+	At  time.Time `json:"at"`
+}
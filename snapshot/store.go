@@ -0,0 +1,166 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Store 快照存储，每个房间只保留最新的一份
+type Store interface {
+	Save(ctx context.Context, s *Snapshot) error
+	// Load 房间没有快照时返回 ErrNotFound
+	Load(ctx context.Context, roomID int64) (*Snapshot, error)
+	Delete(ctx context.Context, roomID int64) error
+	// List 所有有快照的房间
+	List(ctx context.Context) ([]int64, error)
+}
+
+const fileExt = ".json"
+
+// FileStore 每个房间一个 JSON 文件，先写临时文件再 rename，崩溃时不会留下写了一半的快照
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore dir 不存在时自动创建，每个节点应使用自己的目录
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) path(roomID int64) string {
+	return filepath.Join(s.dir, strconv.FormatInt(roomID, 10)+fileExt)
+}
+
+func (s *FileStore) Save(ctx context.Context, snap *Snapshot) error {
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(snap.RoomID))
+}
+
+func (s *FileStore) Load(ctx context.Context, roomID int64) (*Snapshot, error) {
+	body, err := os.ReadFile(s.path(roomID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(body, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *FileStore) Delete(ctx context.Context, roomID int64) error {
+	err := os.Remove(s.path(roomID))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileStore) List(ctx context.Context) ([]int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var roomIDs []int64
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), fileExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		roomID, err := strconv.ParseInt(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	return roomIDs, nil
+}
+
+// RedisStore 所有房间的快照保存在一个 hash 中，field 为 RoomID，value 为 JSON
+type RedisStore struct {
+	client *redis.Client
+	key    string
+}
+
+// NewRedisStore 每个节点应使用自己的 key，如 "snapshot:" + NodeID
+func NewRedisStore(client *redis.Client, key string) *RedisStore {
+	return &RedisStore{
+		client: client,
+		key:    key,
+	}
+}
+
+func (s *RedisStore) Save(ctx context.Context, snap *Snapshot) error {
+	body, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	return s.client.HSet(ctx, s.key, strconv.FormatInt(snap.RoomID, 10), body).Err()
+}
+
+func (s *RedisStore) Load(ctx context.Context, roomID int64) (*Snapshot, error) {
+	body, err := s.client.HGet(ctx, s.key, strconv.FormatInt(roomID, 10)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	snap := new(Snapshot)
+	if err := json.Unmarshal(body, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, roomID int64) error {
+	return s.client.HDel(ctx, s.key, strconv.FormatInt(roomID, 10)).Err()
+}
+
+func (s *RedisStore) List(ctx context.Context) ([]int64, error) {
+	fields, err := s.client.HKeys(ctx, s.key).Result()
+	if err != nil {
+		return nil, err
+	}
+	roomIDs := make([]int64, 0, len(fields))
+	for _, field := range fields {
+		roomID, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		roomIDs = append(roomIDs, roomID)
+	}
+	return roomIDs, nil
+}